@@ -2,16 +2,55 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botFeedback "github.com/xtraice/go-discord-bot/pkg/bot_feedback"
+	botHistory "github.com/xtraice/go-discord-bot/pkg/bot_history"
+	botPartner "github.com/xtraice/go-discord-bot/pkg/bot_partner"
+	botPhrasebook "github.com/xtraice/go-discord-bot/pkg/bot_phrasebook"
+	botRomanize "github.com/xtraice/go-discord-bot/pkg/bot_romanize"
+	botStudy "github.com/xtraice/go-discord-bot/pkg/bot_study"
+	botTmExport "github.com/xtraice/go-discord-bot/pkg/bot_tmexport"
 	botTranslate "github.com/xtraice/go-discord-bot/pkg/bot_translate"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	botWotd "github.com/xtraice/go-discord-bot/pkg/bot_wotd"
 )
 
-var CmdCenter = []*map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
-	&commands,
-	&botTranslate.TranslateCmds,
-	&botdbStats.StatsCmds,
+// CmdCenter holds the command handlers, filled by registerHandlers once the database is open
+var CmdCenter []map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int)
+
+// ComponentCenter holds the handlers of message components and forms, keyed by the part of their custom ID before the first ':'
+var ComponentCenter []map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// registerHandlers fills CmdCenter and ComponentCenter with the commands of the handlers,
+// the packages that only need the stats get a handler of their own here.
+//
+// @param stats: The handler of the stats.
+// @param translator: The handler of the translate commands.
+// @param feedback: The handler of the translation votes.
+// @param wotd: The handler of the word of the day.
+func registerHandlers(stats *botdbStats.Handler, translator *botTranslate.Handler,
+	feedback *botFeedback.Handler, wotd *botWotd.Handler) {
+	study := botStudy.NewHandler(stats)
+	CmdCenter = []map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		commands,
+		translator.Cmds(),
+		botRomanize.RomanizeCmds,
+		botHistory.NewHandler(stats).Cmds(),
+		botPhrasebook.NewHandler(stats).Cmds(),
+		study.Cmds(),
+		wotd.Cmds(),
+		botPartner.NewHandler(stats).Cmds(),
+		feedback.Cmds(),
+		botTmExport.NewHandler(stats).Cmds(),
+		stats.Cmds(),
+	}
+	ComponentCenter = []map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+		study.Components(),
+		feedback.Components(),
+	}
 }
 
 var commands = map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
@@ -22,6 +61,14 @@ var helpCmds = []*map[string]string{
 	{"<help>": "Get Help"},
 	&botTranslate.TranslateHelpCmds,
 	&botdbStats.StatsHelpCmds,
+	&botRomanize.RomanizeHelpCmds,
+	&botHistory.HistoryHelpCmds,
+	&botPhrasebook.PhrasebookHelpCmds,
+	&botStudy.StudyHelpCmds,
+	&botWotd.WotdHelpCmds,
+	&botPartner.PartnerHelpCmds,
+	&botFeedback.FeedbackHelpCmds,
+	&botTmExport.TmExportHelpCmds,
 }
 
 // func transfroms helpCmds into a string
@@ -35,16 +82,43 @@ func helpCmdsToString() string {
 	return helpStr
 }
 
-func handleCommand(s *discordgo.Session, m *discordgo.MessageCreate, cmd string, guildID, authorID int) {
+// handleCommand runs the registered command cmd names and reports whether there was one.
+func handleCommand(s *discordgo.Session, m *discordgo.MessageCreate, cmd string, guildID, authorID int) bool {
 	fmt.Println("Got Cmd:", cmd)
-	for _, commandMap := range CmdCenter {
-		if commandFunc, ok := (*commandMap)[cmd]; ok {
-			commandFunc(s, m, guildID, authorID)
+	// Try the full command first, then drop trailing words so commands can take arguments
+	words := strings.Fields(cmd)
+	for n := len(words); n > 0; n-- {
+		name := strings.Join(words[:n], " ")
+		for _, commandMap := range CmdCenter {
+			if commandFunc, ok := commandMap[name]; ok {
+				commandFunc(s, m, guildID, authorID)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var customID string
+	if i.Type == discordgo.InteractionModalSubmit {
+		customID = i.ModalSubmitData().CustomID
+	} else {
+		customID = i.MessageComponentData().CustomID
+	}
+	fmt.Println("Got Component:", customID)
+	name, _, _ := strings.Cut(customID, ":")
+	for _, componentMap := range ComponentCenter {
+		if componentFunc, ok := componentMap[name]; ok {
+			componentFunc(s, i)
 			return
 		}
 	}
 }
 
 func handleHelpCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
-	s.ChannelMessageSend(m.ChannelID, helpCmdsToString())
+	// The help is longer than one message can hold
+	if err := botUtils.ChannelMessageSendLong(s, m.ChannelID, helpCmdsToString()); err != nil {
+		fmt.Println("help: ", err)
+	}
 }
@@ -10,10 +10,14 @@ import (
 	"path"
 	"strconv"
 	"syscall"
+	"time"
+	_ "time/tzdata" // Server time zones must load on hosts without a zoneinfo database
 
 	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botFeedback "github.com/xtraice/go-discord-bot/pkg/bot_feedback"
 	botTranslate "github.com/xtraice/go-discord-bot/pkg/bot_translate"
 	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	botWotd "github.com/xtraice/go-discord-bot/pkg/bot_wotd"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -22,8 +26,11 @@ var botContext context.Context
 var credentials_ botCredentials
 
 type botCredentials struct {
-	ApiKey   string `json:"apikey"`
-	BotToken string `json:"bottoken"`
+	ApiKey        string                 `json:"apikey"`
+	ApiKeys       []botTranslate.PoolKey `json:"apikeys"` // Key pool, used instead of ApiKey when set
+	BotToken      string                 `json:"bottoken"`
+	EncryptionKey string                 `json:"encryptionkey"` // Encrypts server API keys at rest
+	Database      *botdbStats.Config     `json:"database"`      // Falls back to the discordBot entry of creds.json when unset
 }
 
 // main is the entry point of the program.
@@ -37,44 +44,83 @@ func main() {
 	}
 	os.Setenv("DISCORD_BOT_TOKEN", credentials_.BotToken)
 
+	stats, err := openDatabase(home)
+	if err != nil {
+		fmt.Println("failed to open database: ", err)
+		os.Exit(1)
+	}
+	defer stats.Close()
+
 	dg, err := discordgo.New("Bot " + os.Getenv("DISCORD_BOT_TOKEN"))
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	// Track this run as a bot session, closed again on shutdown
+	if err := stats.StartBotSession(); err != nil {
+		fmt.Println("failed to start bot session: ", err)
+	}
+
 	// Launch goroutine to check if Monthly translate stat Resets
-	go botdbStats.CheckAndUpdateTranslateReset()
-	// Setup Interval Update Stats, currently 30 secs
-	go botdbStats.UpdateDBInterval(30000)
+	go stats.CheckAndUpdateTranslateReset()
+	// Write changed stats behind to the database, currently every 30 secs
+	go stats.RunWriteBehind(30 * time.Second)
+	// Clear users' daily and monthly quota use when a new period starts, checked every minute
+	go stats.RunQuotaResets(time.Minute)
+	// Delete translation history past its retention, checked daily
+	go stats.RunHistoryPruner(24 * time.Hour)
+	// Servers may register their own API key only when keys can be encrypted
+	if err := botdbStats.SetKeyEncryptionSecret(credentials_.EncryptionKey); err != nil {
+		fmt.Println("server api keys disabled: ", err)
+	}
 
 	// Initialize Translate Client
-	if err := botTranslate.InitTranslateClient(&botContext, credentials_.ApiKey); err != nil {
+	translator, err := botTranslate.NewHandler(botContext, stats, credentials_.ApiKeys)
+	if err != nil {
 		fmt.Println("failed to get translate client: ", err)
 		return
 	}
+	// End idle sticky translation sessions, checked every minute
+	go translator.RunStickySweeper(time.Minute)
+
+	feedback := botFeedback.NewHandler(stats)
+	wotd := botWotd.NewHandler(stats)
+	registerHandlers(stats, translator, feedback, wotd)
 
 	//assign callback to set game status when bot is ready
 	dg.AddHandler(ready)
 
 	//assign callback for when a message is created in the channel
-	dg.AddHandler(messageCreate)
+	dg.AddHandler(newMessageCreate(stats, translator))
+
+	//assign callback for when a button is pressed or a form is submitted
+	dg.AddHandler(interactionCreate)
+
+	//assign callbacks for votes on translations
+	dg.AddHandler(feedback.HandleReactionAdd)
+	dg.AddHandler(feedback.HandleReactionRemove)
 
 	//assign callback for when a new guild(server) is added
 	dg.AddHandler(guildCreate)
 
 	// We need information about guilds (which includes their channels),
-	// messages and voice states.
+	// messages, reactions and voice states.
 	dg.Identify.Intents = discordgo.IntentsGuilds |
 		discordgo.IntentsGuildMessages |
 		discordgo.IntentsGuildVoiceStates |
-		discordgo.IntentsDirectMessages
+		discordgo.IntentsDirectMessages |
+		discordgo.IntentsGuildMessageReactions |
+		discordgo.IntentsDirectMessageReactions
 
 	fmt.Println("setup discord bot")
 	if err := dg.Open(); err != nil {
 		fmt.Println("error opening discord session: ", err)
 	}
 
+	// Post each server's word of the day at its local time, checked every minute
+	go wotd.RunScheduler(dg, time.Minute)
+
 	fmt.Println("Bot now running! Press CTRL+C to exit")
 
 	sc := make(chan os.Signal, 1)
@@ -82,35 +128,70 @@ func main() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
-	botdbStats.SaveNow()
+	translator.StopAllSticky()
+	stats.EndBotSession()
+	stats.SaveNow()
+	translator.CloseTranslateClients()
 	dg.Close()
 }
 
+// openDatabase opens the database of the bot credentials, or the discordBot database of creds.json
+// for credentials without a database config.
+//
+// @param home: The user's home directory.
+// @return *botdbStats.Handler: The handler of the stats commands.
+// @return error: An error if the database could not be opened.
+func openDatabase(home string) (*botdbStats.Handler, error) {
+	if credentials_.Database != nil {
+		return botdbStats.Open(*credentials_.Database)
+	}
+	cfg, err := botdbStats.ConfigFromCredentials(path.Join(home, "/go/src/creds.json"), "discordBot")
+	if err != nil {
+		return nil, err
+	}
+	return botdbStats.Open(cfg)
+}
+
 func ready(s *discordgo.Session, event *discordgo.Ready) {
 
 	// set the playing status
 	s.UpdateGameStatus(0, "Jacked Up & Good To Go")
 }
 
-func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	fmt.Printf("Called messageCreate\n")
-	//Check if Message is from this bot, if so then return
-	if m.Author.ID == s.State.User.ID {
-		fmt.Println("Message is from Bot")
-		return
-	}
-	var cmd string
-	guildID, _ := strconv.Atoi(m.GuildID)
-	authorID, _ := strconv.Atoi(m.Author.ID)
-	if m.GuildID != "" {
-		botdbStats.AddServer(s, m)
-		cmd = botUtils.GetCmd(m.Content)
-	} else {
+// newMessageCreate returns the callback for messages, registering servers with the stats
+// and translating plain messages of sticky sessions.
+func newMessageCreate(stats *botdbStats.Handler, translator *botTranslate.Handler) func(s *discordgo.Session, m *discordgo.MessageCreate) {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		fmt.Printf("Called messageCreate\n")
+		//Check if Message is from this bot, if so then return
+		if m.Author.ID == s.State.User.ID {
+			fmt.Println("Message is from Bot")
+			return
+		}
+		var cmd string
+		guildID, _ := strconv.Atoi(m.GuildID)
+		authorID, _ := strconv.Atoi(m.Author.ID)
+		if m.GuildID != "" {
+			stats.AddServer(s, m)
+			// Mentions and custom emoji are bracketed too, so anything that isn't a command is a plain message
+			cmd = botUtils.GetCmd(m.Content)
+			if cmd == "" || !handleCommand(s, m, cmd, guildID, authorID) {
+				translator.HandleStickyMessage(s, m, guildID, authorID)
+			}
+			return
+		}
+
 		fmt.Println("Message is from Direct Message")
 		cmd = m.Content
+		handleCommand(s, m, cmd, guildID, authorID)
 	}
+}
 
-	handleCommand(s, m, cmd, guildID, authorID)
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent && i.Type != discordgo.InteractionModalSubmit {
+		return
+	}
+	handleComponent(s, i)
 }
 
 func guildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
@@ -144,7 +225,12 @@ func DiscordGetCredentials(jsonFile string) bool {
 		return false
 	}
 
-	if len(credentials_.ApiKey) <= 0 {
+	// A single apikey is a pool of one key without a cap of its own
+	if len(credentials_.ApiKeys) == 0 && len(credentials_.ApiKey) > 0 {
+		credentials_.ApiKeys = []botTranslate.PoolKey{{Name: "default", Key: credentials_.ApiKey}}
+	}
+
+	if len(credentials_.ApiKeys) <= 0 {
 		fmt.Printf("Credentials are empty. credential json incorrect.")
 		return false
 	}
@@ -0,0 +1,82 @@
+// Command tmexport writes the translations kept by the bot for a server as TMX 1.4 or XLIFF 1.2,
+// for reuse in CAT tools.
+//
+//	tmexport -guild <serverID> [-format tmx|xliff] [-src ja] [-tgt en] [-since 2024-01-01] [-until 2024-01-31] [-o file]
+//	         [-driver mysql|sqlite|postgres -dsn <dsn>]
+//
+// Without -driver the discordBot database of $HOME/go/src/creds.json is read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botTmExport "github.com/xtraice/go-discord-bot/pkg/bot_tmexport"
+)
+
+func main() {
+	guildID := flag.Uint64("guild", 0, "ID of the server to export")
+	format := flag.String("format", "tmx", "document format, tmx or xliff")
+	src := flag.String("src", "", "only export translations from this language")
+	tgt := flag.String("tgt", "", "only export translations to this language")
+	since := flag.String("since", "", "only export translations made on or after this date, YYYY-MM-DD")
+	until := flag.String("until", "", "only export translations made on or before this date, YYYY-MM-DD")
+	out := flag.String("o", "", "file to write, standard output if empty")
+	driver := flag.String("driver", "", "database driver, mysql, sqlite or postgres")
+	dsn := flag.String("dsn", "", "database data source name")
+	flag.Parse()
+
+	if *guildID == 0 {
+		fmt.Fprintln(os.Stderr, "tmexport: -guild is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	filter := botdbStats.TMFilter{GuildID: uint(*guildID)}
+	var args []string
+	for key, value := range map[string]string{"src": *src, "tgt": *tgt, "since": *since, "until": *until} {
+		if value != "" {
+			args = append(args, key+"="+value)
+		}
+	}
+	if err := botTmExport.ParseFilterArgs(&filter, args); err != nil {
+		fmt.Fprintln(os.Stderr, "tmexport:", err)
+		os.Exit(2)
+	}
+
+	cfg := botdbStats.Config{Driver: *driver, DSN: *dsn}
+	if *driver == "" {
+		var err error
+		if cfg, err = botdbStats.ConfigFromCredentials(path.Join(os.Getenv("HOME"), "/go/src/creds.json"), "discordBot"); err != nil {
+			fmt.Fprintln(os.Stderr, "tmexport:", err)
+			os.Exit(1)
+		}
+		cfg.MigrateOnStart = false
+	}
+	stats, err := botdbStats.Open(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tmexport: opening database:", err)
+		os.Exit(1)
+	}
+	defer stats.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "tmexport:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	count, err := botTmExport.NewHandler(stats).Export(w, *format, filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tmexport:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d segments\n", count)
+}
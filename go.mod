@@ -5,9 +5,11 @@ go 1.21.3
 require (
 	cloud.google.com/go/translate v1.9.3
 	github.com/bwmarrin/discordgo v0.27.1
-	github.com/xtraice/go-utils v0.0.0-20231214213322-d3cde0e50713
 	golang.org/x/text v0.14.0
 	google.golang.org/api v0.154.0
+	gorm.io/driver/mysql v1.5.2
+	gorm.io/driver/postgres v1.5.4
+	gorm.io/driver/sqlite v1.5.4
 	gorm.io/gorm v1.25.5
 )
 
@@ -26,6 +28,9 @@ require (
 	github.com/googleapis/enterprise-certificate-proxy v0.3.2 // indirect
 	github.com/googleapis/gax-go/v2 v2.12.0 // indirect
 	github.com/gorilla/websocket v1.5.1 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/pgx/v5 v5.4.3 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/mattn/go-sqlite3 v1.14.18 // indirect
@@ -42,6 +47,4 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231212172506-995d672761c0 // indirect
 	google.golang.org/grpc v1.60.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
-	gorm.io/driver/mysql v1.5.2 // indirect
-	gorm.io/driver/sqlite v1.5.4 // indirect
 )
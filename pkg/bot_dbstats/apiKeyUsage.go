@@ -0,0 +1,94 @@
+package botdbStats
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyUsage is the monthly usage of one provider API key in the bot's key pool.
+type APIKeyUsage struct {
+	gorm.Model
+	Name          string `gorm:"unique;size:64"`
+	SymbolsUsed   uint64
+	MonthlyCap    uint64 // 0 means the key has no cap of its own
+	ResetDay      int
+	ResetDateTime time.Time
+	CooldownUntil time.Time // The key is skipped until then after a quota or auth error
+	LastError     string
+}
+
+// nextResetDate returns the first reset day of month strictly after now, in UTC.
+func nextResetDate(now time.Time, resetDay int) time.Time {
+	resetDay = min(max(resetDay, 1), 28)
+	now = now.UTC()
+	reset := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, time.UTC)
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 1, 0)
+	}
+	return reset
+}
+
+// LoadAPIKeyUsage returns the stored usage of a pool key, creating it if needed.
+// The cap and reset day are taken from the configuration and the usage is reset if its reset date passed.
+//
+// @param name: The name of the key in the bot credentials.
+// @param monthlyCap: The monthly symbol cap of the key, 0 for none.
+// @param resetDay: The day of month the key's usage resets, 1 to 28.
+// @return *APIKeyUsage: The key's usage.
+// @return error: An error if the usage could not be read or saved.
+func (h *Handler) LoadAPIKeyUsage(name string, monthlyCap uint64, resetDay int) (*APIKeyUsage, error) {
+	usage := &APIKeyUsage{}
+	if res := h.db.Where("name = ?", name).Limit(1).Find(usage); res.Error != nil {
+		return nil, res.Error
+	}
+	usage.Name = name
+	usage.MonthlyCap = monthlyCap
+	if usage.ResetDay != resetDay || usage.ResetDateTime.IsZero() {
+		usage.ResetDay = resetDay
+		usage.ResetDateTime = nextResetDate(time.Now(), resetDay)
+	}
+	ResetAPIKeyUsageIfDue(usage)
+	return usage, h.db.Save(usage).Error
+}
+
+// ResetAPIKeyUsageIfDue clears a key's usage once its reset date has passed.
+// It returns true if the usage was reset.
+func ResetAPIKeyUsageIfDue(usage *APIKeyUsage) bool {
+	if time.Now().Before(usage.ResetDateTime) {
+		return false
+	}
+	usage.SymbolsUsed = 0
+	usage.CooldownUntil = time.Time{}
+	usage.ResetDateTime = nextResetDate(time.Now(), usage.ResetDay)
+	return true
+}
+
+// SaveAPIKeyUsage stores a pool key's usage.
+func (h *Handler) SaveAPIKeyUsage(usage *APIKeyUsage) {
+	if res := h.db.Save(usage); res.Error != nil {
+		fmt.Printf("dbStats::SaveAPIKeyUsage::%s\n", res.Error.Error())
+	}
+}
+
+// FormatAPIKeyUsage returns the usage of each pool key as a string with one key per line.
+func (h *Handler) FormatAPIKeyUsage() string {
+	var usages []APIKeyUsage
+	if res := h.db.Order("name").Find(&usages); res.Error != nil {
+		return "Failed to read API key usage\n"
+	}
+	var str string
+	for _, u := range usages {
+		limit := "no cap"
+		if u.MonthlyCap > 0 {
+			limit = fmt.Sprintf("%d", u.MonthlyCap)
+		}
+		str += fmt.Sprintf("Key %s: %d / %s, resets %s", u.Name, u.SymbolsUsed, limit, u.ResetDateTime.Format(time.DateOnly))
+		if time.Now().Before(u.CooldownUntil) {
+			str += fmt.Sprintf(", paused until %s (%s)", u.CooldownUntil.Format(time.RFC1123), u.LastError)
+		}
+		str += "\n"
+	}
+	return str
+}
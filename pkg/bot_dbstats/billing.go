@@ -0,0 +1,139 @@
+package botdbStats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+// nextBillingReset returns the first midnight of the billing day strictly after now in a time zone, in UTC.
+// Days past 28 are clamped so every month has a reset.
+//
+// @param now: The current time.
+// @param day: The day of month the cycle starts, 1 to 28.
+// @param loc: The time zone of the cycle.
+// @return time.Time: The next reset.
+func nextBillingReset(now time.Time, day int, loc *time.Location) time.Time {
+	day = min(max(day, 1), 28)
+	local := now.In(loc)
+	reset := time.Date(local.Year(), local.Month(), day, 0, 0, 0, 0, loc)
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 1, 0)
+	}
+	return reset.UTC()
+}
+
+// loadLocation returns the named time zone, UTC if it is empty or unknown.
+func loadLocation(name string) *time.Location {
+	if loc, err := time.LoadLocation(name); err == nil && name != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// billingLocation returns the time zone of the provider's billing cycle, lock must be held.
+func (h *Handler) billingLocation() *time.Location {
+	return loadLocation(h.stats.BillingTimezone)
+}
+
+// billingDay returns the day of month the provider's billing cycle starts, lock must be held.
+func (h *Handler) billingDay() int {
+	if h.stats.BillingCycleDay == 0 {
+		return 1
+	}
+	return int(h.stats.BillingCycleDay)
+}
+
+// BillingDay returns the day of month the provider's billing cycle starts.
+func (h *Handler) BillingDay() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.billingDay()
+}
+
+// BillingTimezone returns the name of the time zone of the provider's billing cycle.
+func (h *Handler) BillingTimezone() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.billingLocation().String()
+}
+
+// SetBillingCycle sets the day of month and time zone the global symbol budget resets in,
+// matching the provider's billing cycle. The next reset moves to the new cycle without resetting now.
+//
+// @param day: The day of month, 1 to 28.
+// @param timezone: An IANA time zone name such as Asia/Tokyo.
+// @return error: An error if the day or time zone is invalid or could not be saved.
+func (h *Handler) SetBillingCycle(day int, timezone string) error {
+	if day < 1 || day > 28 {
+		return fmt.Errorf("billing day must be between 1 and 28")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		return fmt.Errorf("unknown time zone '%s'", timezone)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats.BillingCycleDay = uint8(day)
+	h.stats.BillingTimezone = timezone
+	h.stats.ResetDateTime = nextBillingReset(time.Now(), day, h.billingLocation())
+	return h.updateStats("BillingCycleDay", "BillingTimezone", "ResetDateTime")
+}
+
+// Location returns the time zone of a server's user quota windows, UTC if it has none or it is unknown.
+func (ds *DiscordServer) Location() *time.Location {
+	return loadLocation(ds.Timezone)
+}
+
+// SetServerTimezone sets the time zone a server's daily and monthly user quotas reset in.
+//
+// @param guildID: The server's ID
+// @param timezone: An IANA time zone name such as Asia/Ho_Chi_Minh.
+// @return error: An error if the time zone or server is unknown or could not be saved.
+func (h *Handler) SetServerTimezone(guildID uint, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		return fmt.Errorf("unknown time zone '%s'", timezone)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.Timezone = timezone
+	return h.updateServer(server, "Timezone")
+}
+
+// ServerTimezone returns the name of the time zone a server's user quotas reset in.
+func (h *Handler) ServerTimezone(guildID uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if server := h.findServer(guildID); server != nil {
+		return server.Location().String()
+	}
+	return time.UTC.String()
+}
+
+func (h *Handler) handleTimezoneCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'timezone' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "timezone")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Daily and monthly quotas reset at midnight "+h.ServerTimezone(uint(guildID)))
+		return
+	}
+	if !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	if err := h.SetServerTimezone(uint(guildID), args[0]); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to set the time zone: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, "Daily and monthly quotas now reset at midnight "+args[0])
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,194 @@
+package botdbStats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"gorm.io/gorm"
+)
+
+// Kinds of BotTranslateSession
+const (
+	SessionKindBot    = "bot"    // One run of the bot or one reset period, whichever is shorter
+	SessionKindSticky = "sticky" // A user's sticky translation mode in a channel
+)
+
+// pairName names a translation direction, e.g. "ja→en".
+func pairName(langFrom, langTo string) string {
+	return langFrom + "→" + langTo
+}
+
+// popularPair returns the language pair with the most translations.
+func popularPair(pairs map[string]uint64) string {
+	names := make([]string, 0, len(pairs))
+	for name := range pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best := ""
+	for _, name := range names {
+		if best == "" || pairs[name] > pairs[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+// StartBotSession opens a bot session for this run, closing any session a previous run left open.
+//
+// @return error: An error if the session could not be saved.
+func (h *Handler) StartBotSession() error {
+	res := h.db.Model(&BotTranslateSession{}).
+		Where("kind = ? AND end_date_time < ?", SessionKindBot, time.Unix(0, 0)).
+		Update("end_date_time", gorm.Expr("updated_at"))
+	if res.Error != nil {
+		fmt.Printf("dbStats::StartBotSession::%s\n", res.Error.Error())
+	}
+
+	h.sessionLock.Lock()
+	defer h.sessionLock.Unlock()
+	return h.openBotSession()
+}
+
+// openBotSession creates the row of a new bot session, sessionLock must be held.
+func (h *Handler) openBotSession() error {
+	session := &BotTranslateSession{
+		GoogleTranslateStatsID: h.stats.ID,
+		Kind:                   SessionKindBot,
+		StartDateTime:          time.Now().UTC(),
+	}
+	if res := h.db.Create(session); res.Error != nil {
+		return res.Error
+	}
+	h.botSession = session
+	h.sessionPairs = map[string]uint64{}
+	fmt.Printf("Started bot session %d\n", session.ID)
+	return nil
+}
+
+// saveBotSession stores the open bot session's counts, sessionLock must be held.
+func (h *Handler) saveBotSession() {
+	if h.botSession == nil {
+		return
+	}
+	pairs, _ := json.Marshal(h.sessionPairs)
+	h.botSession.LanguagePairs = pairs
+	h.botSession.PopularLanguage = popularPair(h.sessionPairs)
+	if res := h.db.Save(h.botSession); res.Error != nil {
+		fmt.Printf("dbStats::saveBotSession::%s\n", res.Error.Error())
+	}
+}
+
+// closeBotSession ends the open bot session, sessionLock must be held.
+func (h *Handler) closeBotSession() {
+	if h.botSession == nil {
+		return
+	}
+	h.botSession.EndDateTime = time.Now().UTC()
+	banned, err := h.store.BlacklistedSince(h.botSession.StartDateTime)
+	if err != nil {
+		fmt.Printf("dbStats::closeBotSession::%s\n", err.Error())
+	}
+	h.botSession.BlackListedUsers = make([]string, 0, len(banned))
+	for _, b := range banned {
+		h.botSession.BlackListedUsers = append(h.botSession.BlackListedUsers, strconv.FormatUint(uint64(b.UserID), 10))
+	}
+	h.saveBotSession()
+	fmt.Printf("Ended bot session %d\n", h.botSession.ID)
+	h.botSession = nil
+}
+
+// EndBotSession closes the open bot session on shutdown.
+func (h *Handler) EndBotSession() {
+	h.sessionLock.Lock()
+	defer h.sessionLock.Unlock()
+	h.closeBotSession()
+}
+
+// rolloverBotSession closes the open bot session and starts the next one at a reset.
+func (h *Handler) rolloverBotSession() {
+	h.sessionLock.Lock()
+	defer h.sessionLock.Unlock()
+	if h.botSession == nil {
+		return
+	}
+	h.closeBotSession()
+	if err := h.openBotSession(); err != nil {
+		fmt.Printf("dbStats::rolloverBotSession::%s\n", err.Error())
+	}
+}
+
+// recordSessionTranslate counts a translation and its language pair in the open bot session.
+func (h *Handler) recordSessionTranslate(langFrom, langTo string) {
+	h.sessionLock.Lock()
+	defer h.sessionLock.Unlock()
+	if h.botSession == nil {
+		return
+	}
+	h.botSession.TranslateCount++
+	h.sessionPairs[pairName(langFrom, langTo)]++
+}
+
+// recordSessionSymbols counts translated symbols in the open bot session.
+func (h *Handler) recordSessionSymbols(n int) {
+	h.sessionLock.Lock()
+	defer h.sessionLock.Unlock()
+	if h.botSession == nil {
+		return
+	}
+	h.botSession.SymbolsTranslated += uint64(n)
+}
+
+// FormatBotSessions returns the most recent bot sessions and their totals, one per line.
+//
+// @param n: The number of sessions to list.
+// @return string: The formatted sessions.
+func (h *Handler) FormatBotSessions(n int) string {
+	h.sessionLock.Lock()
+	h.saveBotSession()
+	h.sessionLock.Unlock()
+
+	var sessions []BotTranslateSession
+	if res := h.db.Where("kind = ?", SessionKindBot).Order("start_date_time desc").Limit(n).Find(&sessions); res.Error != nil {
+		return "Failed to read sessions"
+	}
+	if len(sessions) == 0 {
+		return "No sessions recorded yet."
+	}
+	var str string
+	for _, session := range sessions {
+		end := "running"
+		if session.EndDateTime.After(session.StartDateTime) {
+			end = session.EndDateTime.Format(time.DateTime)
+		}
+		popular := session.PopularLanguage
+		if popular == "" {
+			popular = "-"
+		}
+		str += fmt.Sprintf("#%d %s to %s: %d translations, %d symbols, popular %s\n",
+			session.ID, session.StartDateTime.Format(time.DateTime), end,
+			session.TranslateCount, session.SymbolsTranslated, popular)
+	}
+	return str
+}
+
+func (h *Handler) handleSessionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'sessions' Cmd")
+	if !botUtils.IsBotOwner(s, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	n := 10
+	if args := botUtils.GetCmdArgs(m.Content, "sessions"); len(args) > 0 {
+		if v, err := strconv.Atoi(args[0]); err == nil && v > 0 {
+			n = min(v, 50)
+		}
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatBotSessions(n))
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,226 @@
+package botdbStats
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+const defaultWarnPercent = 80
+const defaultHardStopPercent = 100
+
+var ErrSymbolBudgetExceeded = errors.New("monthly symbol budget exceeded")
+
+// SymbolReservation is an estimated symbol cost held against the monthly budget
+// until the provider call finishes.
+type SymbolReservation struct {
+	h        *Handler
+	guildID  uint
+	estimate uint64
+	settled  bool
+}
+
+// ReserveSymbols reserves the estimated symbol cost of a provider call against the monthly budget
+// and the budget of the server the call is made for.
+// It returns ErrSymbolBudgetExceeded if the reservation would pass the hard-stop threshold
+// and ErrServerBudgetExceeded if the server's budget or fair share cannot cover it.
+//
+// @param guildID: The server's ID
+// @param estimate: The estimated number of symbols the call will bill.
+// @return *SymbolReservation: The reservation to settle or release once the call returns.
+// @return error: An error if a budget cannot cover the estimate.
+func (h *Handler) ReserveSymbols(guildID uint, estimate int) (*SymbolReservation, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	est := uint64(estimate)
+	if h.stats.SymbolsTranslated+h.reservedSymbols+est > h.hardStopSymbols() {
+		fmt.Printf("ReserveSymbols: rejected %d symbols, used %d reserved %d\n",
+			est, h.stats.SymbolsTranslated, h.reservedSymbols)
+		return nil, ErrSymbolBudgetExceeded
+	}
+	if err := h.checkServerBudget(guildID, est); err != nil {
+		fmt.Printf("ReserveSymbols: rejected %d symbols for server %d\n", est, guildID)
+		return nil, err
+	}
+	h.reservedSymbols += est
+	h.serverReserved[guildID] += est
+	return &SymbolReservation{h: h, guildID: guildID, estimate: est}, nil
+}
+
+// Settle replaces the reservation with the actual number of symbols billed.
+// It returns true when this call pushed usage past the soft-warning threshold.
+//
+// @param actual: The number of symbols the provider billed.
+// @return bool: Whether the soft-warning threshold was crossed.
+func (r *SymbolReservation) Settle(actual int) bool {
+	if r == nil || r.settled {
+		return false
+	}
+	r.h.lock.Lock()
+	defer r.h.lock.Unlock()
+	r.release()
+	r.h.addTranslatedSymbols(r.guildID, actual)
+	if !r.h.stats.SymbolsWarnSent && r.h.stats.SymbolsTranslated >= r.h.warnSymbols() {
+		r.h.stats.SymbolsWarnSent = true
+		r.h.markStatsDirty()
+		return true
+	}
+	return false
+}
+
+// Release drops the reservation without billing anything, e.g. when the provider call failed.
+func (r *SymbolReservation) Release() {
+	if r == nil || r.settled {
+		return
+	}
+	r.h.lock.Lock()
+	defer r.h.lock.Unlock()
+	r.release()
+}
+
+// release must be called with lock held.
+func (r *SymbolReservation) release() {
+	r.settled = true
+	if r.h.reservedSymbols >= r.estimate {
+		r.h.reservedSymbols -= r.estimate
+	} else {
+		r.h.reservedSymbols = 0
+	}
+	r.h.releaseServerSymbols(r.guildID, r.estimate)
+}
+
+func (h *Handler) warnPercent() uint64 {
+	if h.stats.SymbolsWarnPercent == 0 {
+		return defaultWarnPercent
+	}
+	return uint64(h.stats.SymbolsWarnPercent)
+}
+
+func (h *Handler) hardStopPercent() uint64 {
+	if h.stats.SymbolsHardStopPercent == 0 {
+		return defaultHardStopPercent
+	}
+	return uint64(h.stats.SymbolsHardStopPercent)
+}
+
+func (h *Handler) warnSymbols() uint64 {
+	return h.stats.SymbolsMonthlyCap * h.warnPercent() / 100
+}
+
+func (h *Handler) hardStopSymbols() uint64 {
+	return h.stats.SymbolsMonthlyCap * h.hardStopPercent() / 100
+}
+
+// FormatBudget returns the monthly symbol budget as a string with each value on a new line.
+func (h *Handler) FormatBudget() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var str string
+	str += fmt.Sprintf("Symbols Translated: %d\n", h.stats.SymbolsTranslated)
+	str += fmt.Sprintf("Symbols Reserved: %d\n", h.reservedSymbols)
+	str += fmt.Sprintf("Monthly Cap: %d\n", h.stats.SymbolsMonthlyCap)
+	str += fmt.Sprintf("Soft Warning: %d%% (%d symbols)\n", h.warnPercent(), h.warnSymbols())
+	str += fmt.Sprintf("Hard Stop: %d%% (%d symbols)\n", h.hardStopPercent(), h.hardStopSymbols())
+	str += fmt.Sprintf("Billing Cycle: day %d, %s\n", h.billingDay(), h.billingLocation())
+	str += fmt.Sprintf("Resets: %s\n", h.stats.ResetDateTime.In(h.billingLocation()).Format(time.RFC1123))
+	return str
+}
+
+// SetBudgetThresholds sets the soft-warning and hard-stop thresholds as a percentage of the monthly cap.
+// A zero value leaves that threshold unchanged.
+//
+// @param warn: The soft-warning percentage.
+// @param stop: The hard-stop percentage.
+// @return error: An error if the thresholds are out of range.
+func (h *Handler) SetBudgetThresholds(warn, stop uint8) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	newWarn, newStop := uint8(h.warnPercent()), uint8(h.hardStopPercent())
+	if warn != 0 {
+		newWarn = warn
+	}
+	if stop != 0 {
+		newStop = stop
+	}
+	if newWarn > 100 || newStop > 100 || newWarn > newStop {
+		return fmt.Errorf("thresholds must be between 1 and 100 and warning must not exceed hard stop")
+	}
+	h.stats.SymbolsWarnPercent = newWarn
+	h.stats.SymbolsHardStopPercent = newStop
+	h.stats.SymbolsWarnSent = h.stats.SymbolsTranslated >= h.warnSymbols()
+	return h.saveBudget()
+}
+
+// SetMonthlyCap sets the monthly symbol cap of the translation provider.
+func (h *Handler) SetMonthlyCap(symbolCap uint64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats.SymbolsMonthlyCap = symbolCap
+	h.stats.SymbolsWarnSent = h.stats.SymbolsTranslated >= h.warnSymbols()
+	return h.saveBudget()
+}
+
+// saveBudget saves the budget settings of the stats, lock must be held.
+func (h *Handler) saveBudget() error {
+	return h.updateStats("SymbolsMonthlyCap", "SymbolsWarnPercent",
+		"SymbolsHardStopPercent", "SymbolsWarnSent")
+}
+
+func (h *Handler) handleBudgetCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'budget' Cmd")
+	if !botUtils.IsBotOwner(s, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+
+	args := botUtils.GetCmdArgs(m.Content, "budget")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, h.FormatBudget()+"\n"+h.FormatAPIKeyUsage())
+		return
+	}
+	if len(args) != 2 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <budget>, <budget warn 80>, <budget stop 95>, <budget cap 500000>, "+
+			"<budget cycle 15> or <budget timezone Asia/Tokyo>")
+		return
+	}
+
+	var err error
+	switch args[0] {
+	case "warn", "stop":
+		var pct uint64
+		if pct, err = strconv.ParseUint(args[1], 10, 8); err == nil && pct > 0 {
+			if args[0] == "warn" {
+				err = h.SetBudgetThresholds(uint8(pct), 0)
+			} else {
+				err = h.SetBudgetThresholds(0, uint8(pct))
+			}
+		} else if err == nil {
+			err = fmt.Errorf("threshold must be greater than 0")
+		}
+	case "cap":
+		var symbolCap uint64
+		if symbolCap, err = strconv.ParseUint(args[1], 10, 64); err == nil {
+			err = h.SetMonthlyCap(symbolCap)
+		}
+	case "cycle":
+		var day int
+		if day, err = strconv.Atoi(args[1]); err == nil {
+			err = h.SetBillingCycle(day, h.BillingTimezone())
+		}
+	case "timezone":
+		err = h.SetBillingCycle(h.BillingDay(), args[1])
+	default:
+		err = fmt.Errorf("unknown budget setting '%s'", args[0])
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to update budget: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatBudget())
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,156 @@
+package botdbStats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Database drivers supported by Open
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Config describes the database the bot keeps its stats in.
+type Config struct {
+	Driver          string        `json:"driver"` // mysql, sqlite or postgres
+	DSN             string        `json:"dsn"`    // Driver specific data source name, a file path for sqlite
+	MaxOpenConns    int           `json:"maxopenconns"`
+	MaxIdleConns    int           `json:"maxidleconns"`
+	ConnMaxLifetime time.Duration `json:"connmaxlifetime"` // Nanoseconds, 0 keeps connections open
+	MigrateOnStart  bool          `json:"migrateonstart"`  // Create or update the tables when opening
+}
+
+// models are the tables migrated by Open.
+var models = []interface{}{
+	&GoogleTranslateStats{}, &BlacklistedUser{}, &BotTranslateSession{}, &DiscordServer{}, &DiscordUser{},
+	&UserLangStats{}, &GuildAPIKey{}, &APIKeyUsage{}, &TranslationRecord{}, &PhrasebookEntry{}, &StudyCard{},
+	&WordOfTheDayConfig{}, &WordListEntry{}, &WordOfTheDayPost{}, &PartnerOptIn{}, &PartnerMatch{},
+	&TranslationFeedback{}, &TranslationVote{}, &TranslationCorrection{}, &QuotaReset{}, &QuotaAudit{}, &QuotaTier{},
+}
+
+// tableModels are the tables kept outside the stats, in the database given to NewHandler.
+var tableModels = []interface{}{
+	&BotTranslateSession{}, &GuildAPIKey{}, &APIKeyUsage{}, &TranslationRecord{}, &PhrasebookEntry{}, &StudyCard{},
+	&WordOfTheDayConfig{}, &WordListEntry{}, &WordOfTheDayPost{}, &PartnerOptIn{}, &PartnerMatch{},
+	&TranslationFeedback{}, &TranslationVote{}, &TranslationCorrection{},
+}
+
+// Open connects to the configured database, migrates it if asked to and loads the bot's stats from it.
+//
+// @param cfg: The database configuration.
+// @return *Handler: The handler of the stats, close it with Close.
+// @return error: An error if the database is unreachable, could not be migrated or holds no readable stats.
+func Open(cfg Config) (*Handler, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverMySQL:
+		dialector = mysql.Open(cfg.DSN)
+	case DriverSQLite:
+		dialector = sqlite.Open(cfg.DSN)
+	case DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	case "":
+		return nil, errors.New("no database driver configured")
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s', use %s, %s or %s", cfg.Driver, DriverMySQL, DriverSQLite, DriverPostgres)
+	}
+	if cfg.DSN == "" {
+		return nil, errors.New("no database dsn configured")
+	}
+
+	conn, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s database: %w", cfg.Driver, err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connecting to %s database: %w", cfg.Driver, err)
+	}
+
+	if cfg.MigrateOnStart {
+		if err := conn.AutoMigrate(models...); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("migrating database: %w", err)
+		}
+	}
+	handler, err := NewHandler(NewGormStore(conn), conn)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("loading stats: %w", err)
+	}
+	return handler, nil
+}
+
+// Close closes the database of a handler returned by Open.
+func (h *Handler) Close() error {
+	if h.db == nil {
+		return nil
+	}
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// ConfigFromCredentials builds a config from a database entry of a credentials file in the
+// {"Database": [{"name", "type", "username", "password"}]} format the bot used before it had a database config.
+//
+// @param jsonFile: The credentials file.
+// @param name: The name of the database entry to use.
+// @return Config: The config, migrating on start.
+// @return error: An error if the file could not be read or has no such entry.
+func ConfigFromCredentials(jsonFile, name string) (Config, error) {
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		return Config{}, err
+	}
+	var creds struct {
+		Database []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"Database"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", jsonFile, err)
+	}
+	for _, entry := range creds.Database {
+		if entry.Name != name {
+			continue
+		}
+		cfg := Config{Driver: entry.Type, MigrateOnStart: true}
+		switch entry.Type {
+		case DriverSQLite:
+			cfg.DSN = entry.Name
+		case DriverPostgres:
+			cfg.DSN = fmt.Sprintf("user=%s password=%s dbname=%s", entry.Username, entry.Password, entry.Name)
+		default:
+			cfg.DSN = fmt.Sprintf("%s:%s@/%s?charset=utf8&parseTime=True&loc=Local", entry.Username, entry.Password, entry.Name)
+		}
+		return cfg, nil
+	}
+	return Config{}, fmt.Errorf("%s: no database named '%s'", jsonFile, name)
+}
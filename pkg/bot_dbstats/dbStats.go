@@ -4,8 +4,6 @@ import (
 	"cmp"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path"
 	"slices"
 	"sort"
 	"strconv"
@@ -14,28 +12,86 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/xtraice/go-utils/database"
 	"gorm.io/gorm"
 )
 
-var lock = &sync.Mutex{}
-var db *gorm.DB
-var stats_ *GoogleTranslateStats
-var once sync.Once
 var userMonthlyQuota = 1000
 var userDailyQuota = 30
-
-var StatsCmds = map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
-	"translate users": handleTranslateUsersCommand,
-	"userstats":       handleUserStatsCommand,
+var userMonthlyCharQuota = 100000
+var userDailyCharQuota = 5000
+
+// Handler holds the bot's stats loaded from a store and serves the stats commands, writing every change
+// back through the store. Each Handler keeps its own copy of the stats, so several can run side by side.
+type Handler struct {
+	store StatsStore
+	db    *gorm.DB // The tables kept outside the stats
+
+	lock  sync.Mutex // Guards stats, the reservations and the dirty rows
+	stats *GoogleTranslateStats
+
+	// Symbols reserved by provider calls that have not settled yet, in total and per server
+	reservedSymbols uint64
+	serverReserved  map[uint]uint64
+
+	// Rows changed in memory since the last flush, guarded by lock
+	dirtyStats   bool
+	dirtyServers map[uint]bool
+	dirtyUsers   map[uint]bool
+	// flushLock keeps flushes from overlapping so an older snapshot never overwrites a newer one.
+	flushLock sync.Mutex
+
+	// The open bot session, nil before StartBotSession and after EndBotSession, and its language pair counts,
+	// guarded by sessionLock
+	sessionLock  sync.Mutex
+	botSession   *BotTranslateSession
+	sessionPairs map[string]uint64
+
+	// The latest period reset per server and kind, cached and guarded by quotaResetsLock
+	quotaResetsLock sync.Mutex
+	lastQuotaResets map[quotaResetKey]time.Time
+
+	rateLock    sync.Mutex
+	rateBuckets map[rateKey]*tokenBucket
+
+	// The latest translations, remembered for replies to the bot whether or not their server keeps history,
+	// guarded by recentLock
+	recentLock         sync.Mutex
+	recentTranslations map[string]TranslationRecord
+	recentOrder        []string
+
+	// Approved corrections, loaded on first use and guarded by correctionsLock
+	correctionsLock sync.Mutex
+	corrections     map[correctionKey]string
+}
+
+// Cmds returns the stats commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"translate users": h.handleTranslateUsersCommand,
+		"userstats":       h.handleUserStatsCommand,
+		"budget":          h.handleBudgetCommand,
+		"sessions":        h.handleSessionsCommand,
+		"serverbudget":    h.handleServerBudgetCommand,
+		"timezone":        h.handleTimezoneCommand,
+		"ratelimit":       h.handleRateLimitCommand,
+		"quota":           h.handleQuotaCommand,
+		"quotatier":       h.handleQuotaTierCommand,
+	}
 }
 
 var StatsHelpCmds = map[string]string{
 	"<translate users>": "Get List of all Translating Users in Server",
 	"<userstats>":       "Get User Stats for Self '<userstats>' or Another User '<userstats> <username>'",
+	"<budget>":          "Owner: View the monthly symbol budget or set it '<budget warn|stop <percent>>', '<budget cap <symbols>>', '<budget cycle <day>>', '<budget timezone <zone>>'",
+	"<sessions>":        "Owner: List recent bot sessions and their totals '<sessions [n]>'",
+	"<timezone>":        "View the time zone this Server's daily and monthly quotas reset in, Admin: '<timezone Asia/Tokyo>'",
+	"<serverbudget>":    "View this Server's symbol budget, Owner: '<serverbudget set <symbols>>', '<serverbudget rule release|rollover>'",
+	"<quota>":           "View your quota '<quota show>', Admin: '<quota show @user>', '<quota set @user daily|monthly|dailychars|monthlychars <n>>', '<quota reset @user>', '<quota default [daily|monthly|dailychars|monthlychars <n>]>'",
+	"<quotatier>":       "List the quota tiers of this Server's roles, Admin: '<quotatier set @role <daily> <monthly> <dailychars> <monthlychars>>', '<quotatier remove @role>'",
+	"<ratelimit>":       "Owner: View the translation rate limits or set them '<ratelimit user|channel|guild <characters> <seconds>>', '<ratelimit requests on|off>'",
 }
 
-func handleTranslateUsersCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+func (h *Handler) handleTranslateUsersCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
 	fmt.Println("Got 'translate users' Cmd")
 	fmt.Printf("Permission needed: %x\n", discordgo.PermissionAdministrator)
 
@@ -54,7 +110,7 @@ func handleTranslateUsersCommand(s *discordgo.Session, m *discordgo.MessageCreat
 		}
 		guild, _ := s.State.Guild(m.GuildID)
 		str := fmt.Sprintf("Server: %s\n\n", guild.Name)
-		for _, user := range GetServerUsers(uint(gid)) {
+		for _, user := range h.GetServerUsers(uint(gid)) {
 			str += fmt.Sprintf("%s, since: %s\n", user.Username, user.CreatedAt.Format(time.DateOnly))
 		}
 		s.ChannelMessageSend(m.ChannelID, str)
@@ -64,7 +120,7 @@ func handleTranslateUsersCommand(s *discordgo.Session, m *discordgo.MessageCreat
 	fmt.Println("End Cmd")
 }
 
-func handleUserStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+func (h *Handler) handleUserStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
 	fmt.Println("Got 'get user stats' Cmd")
 	fmt.Printf("Permission needed: %x\n", discordgo.PermissionAdministrator)
 	var enStr string
@@ -75,7 +131,7 @@ func handleUserStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, gu
 	fmt.Println("User:", enStr)
 
 	var sUser DiscordUser
-	for _, user := range GetAllUsers() {
+	for _, user := range h.GetAllUsers() {
 		if user.Username == enStr {
 			sUser = user
 			fmt.Println("Found User")
@@ -94,7 +150,7 @@ func handleUserStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, gu
 
 		fmt.Println("Is Admin or User")
 
-		s.ChannelMessageSend(m.ChannelID, FormatUserStats(sUser.ID))
+		s.ChannelMessageSend(m.ChannelID, h.FormatUserStats(sUser.ID))
 	} else {
 		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
 	}
@@ -103,11 +159,31 @@ func handleUserStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, gu
 
 type GoogleTranslateStats struct {
 	gorm.Model
-	ResetDateTime     time.Time `gorm:"type:datetime"`
-	LastUserSuccess   time.Time `gorm:"type:datetime"`
-	LastUserFailure   time.Time `gorm:"type:datetime"`
-	SymbolsTranslated uint64
+	ResetDateTime     time.Time
+	LastUserSuccess   time.Time
+	LastUserFailure   time.Time
+	SymbolsTranslated uint64 `gorm:"default:0"`
 	SymbolsMonthlyCap uint64
+	// Soft-warning and hard-stop thresholds as a percentage of SymbolsMonthlyCap, 0 uses the default
+	SymbolsWarnPercent     uint8
+	SymbolsHardStopPercent uint8
+	SymbolsWarnSent        bool
+	// Symbols each server may use once the pool passes the soft-warning threshold, 0 while the pool is not low
+	FairShareSymbols uint64
+	// Days translation history is kept, 0 uses the default
+	HistoryRetentionDays uint
+	// Day of month and IANA time zone the provider's billing cycle starts, 0 and empty use the 1st in UTC
+	BillingCycleDay uint8
+	BillingTimezone string `gorm:"size:64"`
+	// Characters a user, channel or server may translate per rolling window of seconds, 0 uses the default
+	UserRateChars      uint32
+	UserRateSeconds    uint32
+	ChannelRateChars   uint32
+	ChannelRateSeconds uint32
+	GuildRateChars     uint32
+	GuildRateSeconds   uint32
+	// Also hold users to their daily and monthly request-count quotas, not only to their character quotas
+	RequestQuotas     bool
 	TranslateSessions []BotTranslateSession `gorm:"foreignKey:GoogleTranslateStatsID"`
 	BlacklistedUsers  []BlacklistedUser     `gorm:"foreignKey:GoogleTranslateStatsID"`
 	Servers           []DiscordServer       `gorm:"foreignKey:GoogleTranslateStatsID"`
@@ -115,41 +191,71 @@ type GoogleTranslateStats struct {
 
 type BlacklistedUser struct {
 	gorm.Model
-	GoogleTranslateStatsID uint        // Foreign key referencing the ID field from GoogleTranslateStats
-	StartBanDateTime       time.Time   `gorm:"type:datetime"`
-	EndBanDateTime         time.Time   `gorm:"type:datetime"`
+	GoogleTranslateStatsID uint // Foreign key referencing the ID field from GoogleTranslateStats
+	StartBanDateTime       time.Time
+	EndBanDateTime         time.Time
 	UserID                 uint        `gorm:"unique"` // Add a unique constraint
 	User                   DiscordUser `gorm:"foreignKey:UserID"`
 }
 
 type BotTranslateSession struct {
 	gorm.Model
-	GoogleTranslateStatsID uint      // Foreign key referencing the ID field from GoogleTranslateStats
-	StartDateTime          time.Time `gorm:"type:datetime"`
-	EndDateTime            time.Time `gorm:"type:datetime"`
-	PopularLanguage        string
-	BlackListedUsers       []string `gorm:"type:json" json:"blacklisted_users,omitempty"`
+	GoogleTranslateStatsID uint // Foreign key referencing the ID field from GoogleTranslateStats
+	StartDateTime          time.Time
+	EndDateTime            time.Time       // Zero while the session is open
+	Kind                   string          `gorm:"size:16;index"` // SessionKindBot or SessionKindSticky
+	PopularLanguage        string          // The language pair translated most during the session
+	LanguagePairs          json.RawMessage `gorm:"type:json"` // Translations per language pair
+	SymbolsTranslated      uint64
+	BlackListedUsers       []string `gorm:"type:json;serializer:json" json:"blacklisted_users,omitempty"`
+	DiscordServerID        uint
+	DiscordUserID          uint   // The user of a sticky translation session
+	ChannelID              string // The channel of a sticky translation session
+	SourceLanguage         string
+	TargetLanguage         string
+	TranslateCount         uint64
 }
 
 type DiscordUser struct {
 	gorm.Model
 	//GoogleTranslateStatsID uint // Foreign key referencing the ID field from GoogleTranslateStats
-	DiscordServerID  uint // Foreign key referencing the ID field from DiscordServer
-	Username         string
-	DailyQuota       uint16
-	DailyAccrued     uint16
-	MonthlyQuota     uint16
-	MonthlyAccrued   uint16
-	NumOfTranslates  uint64
-	LastTranslateUse time.Time     `gorm:"type:datetime"`
-	LangStats        UserLangStats `gorm:"embedded;embeddedPrefix:lang_stats_"`
+	DiscordServerID uint // Foreign key referencing the ID field from DiscordServer
+	Username        string
+	DailyQuota      uint16 // Requests per day, only enforced while GoogleTranslateStats.RequestQuotas is set
+	DailyAccrued    uint16 `gorm:"default:0"`
+	MonthlyQuota    uint16
+	MonthlyAccrued  uint16 `gorm:"default:0"`
+	// Billed characters per day and month, a quota of 0 is unlimited
+	DailyCharQuota      uint64 `gorm:"default:5000"`
+	DailyCharsAccrued   uint64 `gorm:"default:0"`
+	MonthlyCharQuota    uint64 `gorm:"default:100000"`
+	MonthlyCharsAccrued uint64 `gorm:"default:0"`
+	NumOfTranslates     uint64 `gorm:"default:0"`
+	LastTranslateUse    time.Time
+	LangStats           UserLangStats `gorm:"embedded;embeddedPrefix:lang_stats_"`
 }
 
 type DiscordServer struct {
 	gorm.Model
 	GoogleTranslateStatsID uint // Foreign key referencing the ID field from GoogleTranslateStats
 	ServerName             string
-	Members                []DiscordUser `gorm:"foreignKey:DiscordServerID"`
+	SymbolBudget           uint64 // Monthly symbols this server may use, 0 shares the global pool
+	SymbolsUsed            uint64 `gorm:"default:0"`
+	SymbolCarryOver        uint64
+	UnusedShare            string // UnusedShareRelease or UnusedShareRollover
+	FairShareBaseline      uint64 // SymbolsUsed when the global pool went low
+	StickyTimeoutMinutes   uint   // Idle minutes before sticky translation ends, 0 uses the default
+	HistoryDisabled        bool   // Keep no translation history for this server
+	TrustedRoleID          string // Members with this role may correct translations directly
+	Timezone               string `gorm:"size:64"` // IANA time zone of the user quota windows, empty for UTC
+	// Quotas given to new members, 0 uses the bot's default
+	DefaultDailyQuota       uint16
+	DefaultMonthlyQuota     uint16
+	DefaultDailyCharQuota   uint64
+	DefaultMonthlyCharQuota uint64
+	Members                 []DiscordUser     `gorm:"foreignKey:DiscordServerID"`
+	Phrasebook              []PhrasebookEntry `gorm:"foreignKey:DiscordServerID"`
+	QuotaTiers              []QuotaTier       `gorm:"foreignKey:DiscordServerID"`
 }
 
 type UserLangStats struct {
@@ -161,7 +267,7 @@ func (uls *UserLangStats) GetFromAsSlice() []string {
 	var langs []string
 	err := json.Unmarshal(uls.FromLanguage, &langs)
 	if err != nil {
-		fmt.Errorf("failed to unmarshal FromLanguage: %v", uls.FromLanguage)
+		fmt.Printf("failed to unmarshal FromLanguage: %v\n", uls.FromLanguage)
 		return nil
 	}
 	return langs
@@ -171,7 +277,7 @@ func (uls *UserLangStats) GetToAsSlice() []string {
 	var langs []string
 	err := json.Unmarshal(uls.ToLanguage, &langs)
 	if err != nil {
-		fmt.Errorf("failed to unmarshal ToLanguage: %v", uls.ToLanguage)
+		fmt.Printf("failed to unmarshal ToLanguage: %v\n", uls.ToLanguage)
 		return nil
 	}
 	return langs
@@ -197,128 +303,119 @@ func (uls *UserLangStats) SetToLanguage(langs []string) error {
 	return nil
 }
 
-func BotDbConnect() bool {
-	home := os.Getenv("HOME")
-	if t := database.GetCredentials(path.Join(home, "/go/src/creds.json")); !t {
-		return false
-	}
-	if !database.Connect("discordBot") {
-		return false
-	}
-	db = database.GetDB()
-	db.AutoMigrate(&GoogleTranslateStats{}, &BlacklistedUser{}, &BotTranslateSession{}, &DiscordUser{}, &UserLangStats{})
-	return true
-}
-
-func init() {
-	home := os.Getenv("HOME")
-	database.GetCredentials(path.Join(home, "/go/src/creds.json"))
-	database.Connect("discordBot")
-	db = database.GetDB()
-	db.AutoMigrate(&GoogleTranslateStats{}, &BlacklistedUser{}, &BotTranslateSession{}, &UserLangStats{})
-	// if dbs := db.Where("ID=?", 1).Find(*stats); dbs.Error != nil {
-	stats_ = getInstance() //singleton
-	if dbs := db.Preload("BlacklistedUsers").
-		Preload("TranslateSessions").
-		Preload("Servers").
-		Preload("Servers.Members").
-		Where("ID=?", 1).
-		First(stats_); dbs.Error != nil {
-		TranslateBotStatsInit()
-	}
-	fmt.Printf("symbols translated: %d\n", stats_.SymbolsTranslated)
-
-}
-
-func TranslateBotStatsInit() {
-	fmt.Println("INIT Translate Stats Table")
-	db.Create(&stats_)
-}
-
-// getInstance returns the singleton instance
-func getInstance() *GoogleTranslateStats {
-	once.Do(func() {
-		if stats_ == nil {
-			lock.Lock()
-			defer lock.Unlock()
-			if stats_ == nil {
-				fmt.Println("Creating Singleton Instance")
-				stats_ = &GoogleTranslateStats{
-					Model: gorm.Model{ID: 1},
-					ResetDateTime: time.Date(time.Now().UTC().Year(), time.Now().UTC().Month(), 1,
-						0, 0, 0, 0, time.Now().UTC().Location()).AddDate(0, 1, 0),
-					LastUserSuccess:   time.Now().UTC(),
-					LastUserFailure:   time.Now().UTC(),
-					SymbolsMonthlyCap: 500000,
-					SymbolsTranslated: 0,
-				}
-			} else {
-				fmt.Println("Singleton already created")
-			}
-		} else {
-			fmt.Println("Singleton already created")
+// NewHandler loads the bot's stats from a store and keeps writing them back to it.
+//
+// @param store: The store holding the stats.
+// @param db: The database of the tables kept outside the stats, such as sessions, history, feedback,
+// study cards, words of the day, partners, phrasebooks and server keys.
+// @return *Handler: The handler of the stats, saving through store.
+// @return error: An error if the stats could not be loaded.
+func NewHandler(store StatsStore, db *gorm.DB) (*Handler, error) {
+	stats, err := store.LoadStats()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("symbols translated: %d\n", stats.SymbolsTranslated)
+	return &Handler{
+		store:              store,
+		db:                 db,
+		stats:              stats,
+		serverReserved:     map[uint]uint64{},
+		dirtyServers:       map[uint]bool{},
+		dirtyUsers:         map[uint]bool{},
+		lastQuotaResets:    map[quotaResetKey]time.Time{},
+		rateBuckets:        map[rateKey]*tokenBucket{},
+		recentTranslations: map[string]TranslationRecord{},
+	}, nil
+}
+
+// addTranslatedSymbols counts symbols billed by the provider for a server, lock must be held.
+// The store adds them to the stored totals, which are then copied back so other bot processes' use shows.
+func (h *Handler) addTranslatedSymbols(guildID uint, s int) {
+	total, serverUsed, err := h.store.AddSymbols(h.stats.ID, guildID, uint64(s))
+	server := h.findServer(guildID)
+	if err != nil {
+		fmt.Printf("dbStats::addTranslatedSymbols::%s\n", err.Error())
+		total = h.stats.SymbolsTranslated + uint64(s)
+		if server != nil {
+			serverUsed = server.SymbolsUsed + uint64(s)
 		}
-	})
-	return stats_
-}
-
-func UpdateLocalSymbolCnt(s int) {
-	stats_.SymbolsTranslated += uint64(s)
-	fmt.Printf("UpdateLocalSymbolCnt: %d\n", stats_.SymbolsTranslated)
-
+	}
+	h.stats.SymbolsTranslated = total
+	if server != nil {
+		server.SymbolsUsed = serverUsed
+	}
+	h.recordSessionSymbols(s)
+	fmt.Printf("addTranslatedSymbols: %d\n", h.stats.SymbolsTranslated)
 }
 
-func SaveNow() {
-	lock.Lock()
-	defer lock.Unlock()
-	if d := db.Save(stats_); d.Error != nil {
-		fmt.Printf("dbStats::SaveNow():: %s", d.Error.Error())
+// SaveNow flushes the changed stats and saves the open bot session, e.g. on shutdown.
+func (h *Handler) SaveNow() {
+	if err := h.Flush(); err != nil {
+		fmt.Printf("dbStats::SaveNow():: %s\n", err.Error())
+	}
+	h.sessionLock.Lock()
+	h.saveBotSession()
+	h.sessionLock.Unlock()
+}
+
+// EnsureMember adds a user to a server's members with the server's default quotas, so their quotas can be
+// checked and set before their first translation. A user who is already a member is left as they are.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param username: The user's name.
+// @return error: An error if the server is unknown or the member could not be saved.
+func (h *Handler) EnsureMember(guildID, userID uint, username string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, err := h.addMember(guildID, userID, username)
+	return err
+}
+
+// addMember returns a user, adding them to a server's members with its default quotas if they are new,
+// lock must be held.
+func (h *Handler) addMember(guildID, userID uint, username string) (*DiscordUser, error) {
+	if has, user, _ := h.stats.containsUser(userID); has {
+		return user, nil
+	}
+	server := h.findServer(guildID)
+	if server == nil {
+		return nil, fmt.Errorf("could not find a server associated with user")
 	}
+	user := DiscordUser{
+		Model: gorm.Model{
+			ID:        userID,
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+		},
+		Username:        username,
+		DiscordServerID: server.ID,
+	}
+	applyDefaultQuotas(server, &user)
+	if err := h.store.SaveChanges(nil, nil, []DiscordUser{user}); err != nil {
+		return nil, err
+	}
+	n, _ := slices.BinarySearchFunc(server.Members, userID, func(a DiscordUser, b uint) int {
+		return cmp.Compare(a.ID, b)
+	})
+	server.Members = slices.Insert(server.Members, n, user)
+	fmt.Println("Added User")
+	return &server.Members[n], nil
 }
 
-func DiscordUserLangStatUpdate(m discordgo.MessageCreate, langFrom string, langTo string) (bool, error) {
+func (h *Handler) DiscordUserLangStatUpdate(m discordgo.MessageCreate, langFrom string, langTo string) (bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	mId, _ := strconv.Atoi(m.Author.ID)
-	has, pUser, pServer := stats_.containsUser(uint(mId))
+	has, pUser, _ := h.stats.containsUser(uint(mId))
 	fmt.Printf("Msg User: %s\n", m.Author.Username)
 	if !has {
-		user := DiscordUser{
-			Model: gorm.Model{
-				ID:        uint(mId),
-				CreatedAt: time.Now().UTC(),
-				UpdatedAt: time.Now().UTC(),
-			},
-			Username:        m.Author.Username,
-			NumOfTranslates: 0,
-			DailyQuota:      uint16(userDailyQuota),
-			MonthlyQuota:    uint16(userMonthlyQuota),
-			DailyAccrued:    0,
-			MonthlyAccrued:  0,
-		}
 		gid, _ := strconv.Atoi(m.GuildID)
-		n, found := slices.BinarySearchFunc(stats_.Servers, uint(gid), func(a DiscordServer, b uint) int {
-			return cmp.Compare(a.ID, b)
-		})
-
-		if found {
-			pServer = &stats_.Servers[n]
-		} else {
-			return false, fmt.Errorf("could not find a server associated with user")
-		}
-
-		pServer.Members = append(pServer.Members, user)
-
-		//Debug Print
-		if has, _, g := stats_.containsUser(uint(mId)); has {
-			println("Users is stored in stats_")
-			fmt.Printf("%s\n", g.Members[0].Username)
+		var err error
+		if pUser, err = h.addMember(uint(gid), uint(mId), m.Author.Username); err != nil {
+			return false, err
 		}
-
-		pUser = &(pServer.Members[len(pServer.Members)-1])
-		fmt.Println("pUser\n", pUser)
-		sort.Slice(pServer.Members, func(i, j int) bool {
-			return pServer.Members[i].ID < pServer.Members[j].ID
-		})
-		fmt.Println("Added User")
 	} else {
 		fmt.Println("User already exists")
 	}
@@ -347,109 +444,126 @@ func DiscordUserLangStatUpdate(m discordgo.MessageCreate, langFrom string, langT
 	}
 
 	pUser.LastTranslateUse = time.Now().UTC()
-	pUser.NumOfTranslates += 1
-	pUser.DailyAccrued += 1
-	pUser.MonthlyAccrued += 1
-
-	if res := db.Session(&gorm.Session{FullSaveAssociations: true}).Save(stats_); res.Error != nil {
-		fmt.Printf("dbStats::DiscordUserLangStatUpdate::%s\n", res.Error.Error())
+	if count, err := h.store.AddTranslates(pUser.ID, 1); err != nil {
+		fmt.Printf("dbStats::DiscordUserLangStatUpdate::%s\n", err.Error())
+		pUser.NumOfTranslates += 1
+	} else {
+		pUser.NumOfTranslates = count
 	}
+	h.recordSessionTranslate(langFrom, langTo)
+
+	h.markUserDirty(pUser.ID)
 
 	return true, nil
 }
 
-func (*GoogleTranslateStats) containsUser(uid uint) (bool, *DiscordUser, *DiscordServer) {
-
-	for _, s := range stats_.Servers {
+// containsUser finds a user in any server, lock must be held.
+func (gts *GoogleTranslateStats) containsUser(uid uint) (bool, *DiscordUser, *DiscordServer) {
 
+	for i := range gts.Servers {
+		s := &gts.Servers[i]
 		n, found := slices.BinarySearchFunc(s.Members, uid, func(a DiscordUser, b uint) int {
 			return cmp.Compare(a.ID, uid)
 		})
 
 		if found {
-			return true, &s.Members[n], &s
+			return true, &s.Members[n], s
 		}
 	}
 	return false, nil, nil
 }
 
-func GetAllUsers() []DiscordUser {
+func (h *Handler) GetAllUsers() []DiscordUser {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	Users := make([]DiscordUser, 0)
-	for _, server := range stats_.Servers {
+	for _, server := range h.stats.Servers {
 		Users = append(Users, server.Members...)
 	}
 	return Users
 }
 
-func AddServer(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (h *Handler) AddServer(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	id, _ := strconv.Atoi(m.GuildID)
 	mGid := uint(id)
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	// Does server already exist
-	for _, ds := range stats_.Servers {
+	for _, ds := range h.stats.Servers {
 		if ds.ID == mGid {
 			return
 		}
 	}
 	fmt.Println("Adding Server")
-	gName, _ := s.State.Guild(m.GuildID)
+	gName, err := s.State.Guild(m.GuildID)
+	if err != nil {
+		fmt.Printf("dbStats::AddServer::%s\n", err.Error())
+		return
+	}
 	//Create new Server
-	stats_.Servers = append(stats_.Servers, DiscordServer{
+	server := DiscordServer{
 		Model: gorm.Model{
 			ID:        uint(mGid),
 			CreatedAt: time.Now().UTC(),
 			UpdatedAt: time.Now().UTC(),
 		},
-		GoogleTranslateStatsID: 1,
+		GoogleTranslateStatsID: h.stats.ID,
 		ServerName:             gName.Name,
 		Members:                make([]DiscordUser, 0),
-	})
-	sort.Slice(stats_.Servers, func(i, j int) bool {
-		return stats_.Servers[i].ID < stats_.Servers[j].ID
+	}
+	if err := h.store.SaveChanges(nil, []DiscordServer{server}, nil); err != nil {
+		fmt.Printf("dbStats::AddServer::%s\n", err.Error())
+		return
+	}
+	h.stats.Servers = append(h.stats.Servers, server)
+	sort.Slice(h.stats.Servers, func(i, j int) bool {
+		return h.stats.Servers[i].ID < h.stats.Servers[j].ID
 	})
 }
 
-func GetServerUsers(guildId uint) []DiscordUser {
-	for _, server := range stats_.Servers {
-		if server.ID == guildId {
-			return server.Members
-		}
+func (h *Handler) GetServerUsers(guildId uint) []DiscordUser {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if server := h.findServer(guildId); server != nil {
+		return slices.Clone(server.Members)
 	}
 	return nil
 }
 
-func CheckAndUpdateTranslateReset() {
+// CheckAndUpdateTranslateReset resets the global symbol count and server budgets when the billing cycle
+// starts a new month, checking at least every minute so a changed cycle applies promptly.
+// After downtime the missed reset is made once.
+func (h *Handler) CheckAndUpdateTranslateReset() {
 	for {
-		until := time.Until(stats_.ResetDateTime)
-		if until > 0 {
-			time.Sleep(until)
+		h.lock.Lock()
+		now := time.Now()
+		if !now.Before(h.stats.ResetDateTime) {
+			h.stats.ResetDateTime = nextBillingReset(now, h.billingDay(), h.billingLocation())
+			h.stats.SymbolsTranslated = 0
+			h.stats.SymbolsWarnSent = false
+			h.rolloverServerBudgets()
+			h.rolloverBotSession()
+			if err := h.updateStats("ResetDateTime", "SymbolsTranslated", "SymbolsWarnSent", "FairShareSymbols"); err != nil {
+				fmt.Printf("dbStats::CheckAndUpdateTranslateReset::%s\n", err.Error())
+			}
 		}
-		stats_.ResetDateTime = stats_.ResetDateTime.AddDate(0, 1, 0)
-		stats_.SymbolsTranslated = 0
-		newStat := GoogleTranslateStats{
-			ResetDateTime:     stats_.ResetDateTime,
-			SymbolsTranslated: stats_.SymbolsTranslated}
-
-		db.Model(stats_).Updates(newStat)
+		until := time.Until(h.stats.ResetDateTime)
+		h.lock.Unlock()
+		time.Sleep(min(max(until, time.Second), time.Minute))
 	}
 }
 
-func UpdateDBInterval(intervalMSecs int64) {
-	now := time.Now().UTC().UnixMilli()
-	start := now
-	for {
-		now := time.Now().UTC().UnixMilli()
-		if res := now - start; res > intervalMSecs {
-			SaveNow()
-			start = now
-			fmt.Println("Saved Stats (Interval)")
-		}
-	}
+// A function to check if a user is blacklisted
+func (h *Handler) IsBlacklisted(uid uint) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.isBlacklisted(uid)
 }
 
-// A function to check if a user is blacklisted
-func IsBlacklisted(uid uint) bool {
-	for _, u := range stats_.BlacklistedUsers {
+// isBlacklisted must be called with lock held.
+func (h *Handler) isBlacklisted(uid uint) bool {
+	for _, u := range h.stats.BlacklistedUsers {
 		if u.UserID == uid {
 			return true
 		}
@@ -458,51 +572,53 @@ func IsBlacklisted(uid uint) bool {
 }
 
 // A function to add a user to the blacklist
-func AddToBlacklist(uid uint) {
-	stats_.BlacklistedUsers = append(stats_.BlacklistedUsers, BlacklistedUser{
+func (h *Handler) AddToBlacklist(uid uint) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.isBlacklisted(uid) {
+		return
+	}
+	entry := BlacklistedUser{
 		Model: gorm.Model{
 			CreatedAt: time.Now().UTC(),
 			UpdatedAt: time.Now().UTC(),
 		},
-		GoogleTranslateStatsID: 1,
+		GoogleTranslateStatsID: h.stats.ID,
 		UserID:                 uid,
 		StartBanDateTime:       time.Now().UTC(),
 		EndBanDateTime:         time.Now().UTC().AddDate(0, 0, 7),
-	})
-}
-
-// A function to remove a user from the blacklist
-func RemoveFromBlacklist(uid uint) {
-	for i, u := range stats_.BlacklistedUsers {
-		if u.UserID == uid {
-			stats_.BlacklistedUsers = append(stats_.BlacklistedUsers[:i], stats_.BlacklistedUsers[i+1:]...)
-		}
 	}
+	if err := h.store.AddBlacklisted(&entry); err != nil {
+		fmt.Printf("dbStats::AddToBlacklist::%s\n", err.Error())
+		return
+	}
+	h.stats.BlacklistedUsers = append(h.stats.BlacklistedUsers, entry)
 }
 
-// ResetDailyQuota resets the daily quota for a user identified by their UID.
-// It iterates through all the servers and members in the stats_ variable and checks if the user ID matches.
-// If the user's last translation usage is not from the current day, their daily accrued count is reset to 0.
-// @param uid: The user's ID
-func ResetDailyQuota(uid uint) {
-	for _, s := range stats_.Servers {
-		for _, u := range s.Members {
-			if u.ID == uid {
-				if u.LastTranslateUse.Day() != time.Now().UTC().Day() {
-					u.DailyAccrued = 0
-				}
-			}
-		}
+// A function to remove a user from the blacklist
+func (h *Handler) RemoveFromBlacklist(uid uint) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err := h.store.RemoveBlacklisted(uid); err != nil {
+		fmt.Printf("dbStats::RemoveFromBlacklist::%s\n", err.Error())
+		return
 	}
+	h.stats.BlacklistedUsers = slices.DeleteFunc(h.stats.BlacklistedUsers, func(u BlacklistedUser) bool {
+		return u.UserID == uid
+	})
 }
 
 // A function to format a user's stats as a string so each stat can be displayed on a new line
-func FormatUserStats(uid uint) string {
+func (h *Handler) FormatUserStats(uid uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
 	var str string
-	for _, s := range stats_.Servers {
+	for _, s := range h.stats.Servers {
 		for _, u := range s.Members {
 			if u.ID == uid {
 				str += fmt.Sprintf("User: %s\n", u.Username)
+				str += fmt.Sprintf("Daily Characters: %d of %s\n", u.DailyCharsAccrued, formatCharQuota(u.DailyCharQuota))
+				str += fmt.Sprintf("Monthly Characters: %d of %s\n", u.MonthlyCharsAccrued, formatCharQuota(u.MonthlyCharQuota))
 				str += fmt.Sprintf("Daily Quota: %d\n", u.DailyQuota)
 				str += fmt.Sprintf("Daily Accrued: %d\n", u.DailyAccrued)
 				str += fmt.Sprintf("Monthly Quota: %d\n", u.MonthlyQuota)
@@ -517,19 +633,23 @@ func FormatUserStats(uid uint) string {
 	return str
 }
 
-// A bool func which receives a serverId and userId,
+// A bool func which receives a serverId, userId and the user's roles,
 // then returns whether a user has exceeded their daily or monthly quota.
+// The quotas are the highest tier of the user's roles, or the user's own quotas if those are higher.
 // @param serverId: The server's ID
 // @param userId: The user's ID
+// @param roles: The IDs of the user's roles in the server
 // @return: A bool indicating whether the user has exceeded their daily quota
-func ExceedsQuotaOrBanned(serverId uint, userId uint) bool {
-	n, found := slices.BinarySearchFunc(stats_.Servers, serverId, func(a DiscordServer, b uint) int {
+func (h *Handler) ExceedsQuotaOrBanned(serverId uint, userId uint, roles []string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	n, found := slices.BinarySearchFunc(h.stats.Servers, serverId, func(a DiscordServer, b uint) int {
 		return cmp.Compare(a.ID, b)
 	})
 	if !found {
 		return true
 	} else {
-		server := stats_.Servers[n]
+		server := h.stats.Servers[n]
 		n, found := slices.BinarySearchFunc(server.Members, userId, func(a DiscordUser, b uint) int {
 			return cmp.Compare(a.ID, b)
 		})
@@ -537,9 +657,9 @@ func ExceedsQuotaOrBanned(serverId uint, userId uint) bool {
 			return true
 		} else {
 			user := server.Members[n]
-			is := IsBlacklisted(userId) ||
-				user.MonthlyAccrued >= user.MonthlyQuota ||
-				user.DailyAccrued >= user.DailyQuota
+			limits := effectiveLimits(&server, &user, roles)
+			is := h.isBlacklisted(userId) || limits.charsUsed(&user) ||
+				h.stats.RequestQuotas && limits.requestsUsed(&user)
 			return is
 		}
 	}
@@ -0,0 +1,257 @@
+package botdbStats
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+)
+
+const testGuildID = 100
+
+// newTestHandler loads a memory store holding one server with the given users, each with a daily quota of chars characters.
+func newTestHandler(t *testing.T, userIDs []uint, chars uint64) (*Handler, StatsStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	db, err := OpenMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := DiscordServer{Model: gorm.Model{ID: testGuildID}, ServerName: "test"}
+	users := make([]DiscordUser, 0, len(userIDs))
+	for _, id := range userIDs {
+		users = append(users, DiscordUser{
+			Model:            gorm.Model{ID: id},
+			Username:         "user" + strconv.FormatUint(uint64(id), 10),
+			DiscordServerID:  testGuildID,
+			DailyQuota:       uint16(userDailyQuota),
+			MonthlyQuota:     uint16(userMonthlyQuota),
+			DailyCharQuota:   chars,
+			MonthlyCharQuota: chars * 10,
+		})
+	}
+	if err := store.SaveChanges(nil, []DiscordServer{server}, users); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler(store, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, store
+}
+
+// testMessage returns a message of a user in the test server.
+func testMessage(userID uint) discordgo.MessageCreate {
+	id := strconv.FormatUint(uint64(userID), 10)
+	return discordgo.MessageCreate{Message: &discordgo.Message{
+		GuildID:   strconv.Itoa(testGuildID),
+		ChannelID: "channel",
+		Author:    &discordgo.User{ID: id, Username: "user" + id},
+	}}
+}
+
+func TestConcurrentStatsUpdates(t *testing.T) {
+	const workersPerUser = 4
+	const rounds = 50
+	const chars = 10
+	const quota = 1000
+	userIDs := []uint{1, 2, 3, 4}
+	newUserIDs := []uint{11, 12, 13}
+	h, store := newTestHandler(t, userIDs, quota)
+	// The first check of a period makes its reset, later checks only compare
+	h.ResetQuotasIfDue()
+
+	var charged [5]atomic.Int64
+	var settled atomic.Int64
+	var newCharged atomic.Int64
+	var newTranslated [14]atomic.Int64
+	var wg sync.WaitGroup
+	for _, id := range userIDs {
+		for w := 0; w < workersPerUser; w++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				m := testMessage(userID)
+				for i := 0; i < rounds; i++ {
+					h.ExceedsQuotaOrBanned(testGuildID, userID, nil)
+					if h.TakeRateLimit(testGuildID, m.ChannelID, userID, chars) == nil {
+						h.ReturnRateLimit(testGuildID, m.ChannelID, userID, chars)
+					}
+					if h.ChargeUserQuota(testGuildID, userID, nil, chars) == nil {
+						charged[userID].Add(chars)
+					}
+					if _, err := h.DiscordUserLangStatUpdate(m, "ja", "en"); err != nil {
+						t.Errorf("DiscordUserLangStatUpdate: %v", err)
+					}
+					reservation, err := h.ReserveSymbols(testGuildID, chars)
+					if err != nil {
+						t.Errorf("ReserveSymbols: %v", err)
+						continue
+					}
+					reservation.Settle(chars)
+					settled.Add(chars)
+				}
+			}(id)
+		}
+	}
+	for _, id := range newUserIDs {
+		wg.Add(1)
+		go func(userID uint) {
+			defer wg.Done()
+			m := testMessage(userID)
+			for i := 0; i < rounds; i++ {
+				if err := h.EnsureMember(testGuildID, userID, m.Author.Username); err != nil {
+					t.Errorf("EnsureMember: %v", err)
+					return
+				}
+				if h.ExceedsQuotaOrBanned(testGuildID, userID, nil) {
+					continue
+				}
+				if h.ChargeUserQuota(testGuildID, userID, nil, chars) == nil {
+					newCharged.Add(chars)
+				}
+				if _, err := h.DiscordUserLangStatUpdate(m, "en", "vi"); err != nil {
+					t.Errorf("DiscordUserLangStatUpdate: %v", err)
+				} else {
+					newTranslated[userID].Add(1)
+				}
+			}
+		}(id)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if err := h.Flush(); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+			h.ResetQuotasIfDue()
+		}
+	}()
+	wg.Wait()
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.LoadStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SymbolsTranslated != uint64(settled.Load()) {
+		t.Errorf("stored %d symbols translated, want %d", stored.SymbolsTranslated, settled.Load())
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.stats.SymbolsTranslated != uint64(settled.Load()) {
+		t.Errorf("%d symbols translated, want %d", h.stats.SymbolsTranslated, settled.Load())
+	}
+	for _, id := range userIDs {
+		if got := charged[id].Load(); got != quota {
+			t.Errorf("user %d was charged %d characters, want the whole quota of %d", id, got, quota)
+		}
+		user := h.findMember(testGuildID, id)
+		if user.DailyCharsAccrued != quota {
+			t.Errorf("user %d has %d characters accrued, want %d", id, user.DailyCharsAccrued, quota)
+		}
+		if user.NumOfTranslates != workersPerUser*rounds {
+			t.Errorf("user %d has %d translations, want %d", id, user.NumOfTranslates, workersPerUser*rounds)
+		}
+		if kept := storedMember(stored, testGuildID, id); kept == nil || kept.DailyCharsAccrued != quota {
+			t.Errorf("stored user %d does not have %d characters accrued", id, quota)
+		}
+	}
+	var newAccrued uint64
+	for _, id := range newUserIDs {
+		user := h.findMember(testGuildID, id)
+		if user == nil {
+			t.Errorf("new user %d was not added", id)
+			continue
+		}
+		if user.DailyCharQuota != uint64(userDailyCharQuota) {
+			t.Errorf("new user %d has a daily character quota of %d, want the default %d", id, user.DailyCharQuota, userDailyCharQuota)
+		}
+		if user.NumOfTranslates == 0 || int64(user.NumOfTranslates) != newTranslated[id].Load() {
+			t.Errorf("new user %d has %d translations, want %d", id, user.NumOfTranslates, newTranslated[id].Load())
+		}
+		kept := storedMember(stored, testGuildID, id)
+		if kept == nil {
+			t.Errorf("new user %d was not stored", id)
+			continue
+		}
+		if kept.DailyCharsAccrued != user.DailyCharsAccrued {
+			t.Errorf("stored new user %d has %d characters accrued, want %d", id, kept.DailyCharsAccrued, user.DailyCharsAccrued)
+		}
+		newAccrued += user.DailyCharsAccrued
+	}
+	if newAccrued != uint64(newCharged.Load()) {
+		t.Errorf("new users have %d characters accrued, want %d", newAccrued, newCharged.Load())
+	}
+}
+
+// storedMember returns a member of a server in stats read back from the store, or nil.
+func storedMember(stats *GoogleTranslateStats, guildID, userID uint) *DiscordUser {
+	for i := range stats.Servers {
+		if stats.Servers[i].ID != guildID {
+			continue
+		}
+		for j := range stats.Servers[i].Members {
+			if stats.Servers[i].Members[j].ID == userID {
+				return &stats.Servers[i].Members[j]
+			}
+		}
+	}
+	return nil
+}
+
+func TestHandlersAreIndependent(t *testing.T) {
+	const chars = 10
+	first, firstStore := newTestHandler(t, []uint{1}, 100)
+	second, secondStore := newTestHandler(t, []uint{1}, 100)
+
+	if err := first.ChargeUserQuota(testGuildID, 1, nil, chars); err != nil {
+		t.Fatal(err)
+	}
+	reservation, err := first.ReserveSymbols(testGuildID, chars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reservation.Settle(chars)
+	if err := first.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		h       *Handler
+		store   StatsStore
+		symbols uint64
+		accrued uint64
+	}{
+		{"first", first, firstStore, chars, chars},
+		{"second", second, secondStore, 0, 0},
+	}
+	for _, tt := range tests {
+		stored, err := tt.store.LoadStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.SymbolsTranslated != tt.symbols {
+			t.Errorf("%s handler stored %d symbols translated, want %d", tt.name, stored.SymbolsTranslated, tt.symbols)
+		}
+		if kept := storedMember(stored, testGuildID, 1); kept == nil || kept.DailyCharsAccrued != tt.accrued {
+			t.Errorf("%s handler's stored user does not have %d characters accrued", tt.name, tt.accrued)
+		}
+		tt.h.lock.Lock()
+		if user := tt.h.findMember(testGuildID, 1); user == nil || user.DailyCharsAccrued != tt.accrued {
+			t.Errorf("%s handler's user does not have %d characters accrued", tt.name, tt.accrued)
+		}
+		tt.h.lock.Unlock()
+	}
+}
@@ -0,0 +1,290 @@
+package botdbStats
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnknownTranslation = errors.New("translation not found")
+
+// correctionKey identifies the text a correction applies to.
+type correctionKey struct {
+	guildID uint
+	from    string
+	to      string
+	text    string
+}
+
+// TranslationFeedback holds the votes of one bot translation.
+type TranslationFeedback struct {
+	gorm.Model
+	MessageID       string `gorm:"size:32;uniqueIndex"` // The bot's reply holding the translation
+	DiscordServerID uint   `gorm:"index"`
+	ChannelID       string `gorm:"size:32"`
+	SourceLanguage  string `gorm:"size:16"`
+	TargetLanguage  string `gorm:"size:16"`
+	SourceText      string `gorm:"type:text"`
+	OutputText      string `gorm:"type:text"`
+	Upvotes         uint
+	Downvotes       uint
+}
+
+// TranslationVote is one user's vote on a bot translation, +1 or -1.
+type TranslationVote struct {
+	gorm.Model
+	MessageID     string `gorm:"size:32;uniqueIndex:idx_translation_vote"`
+	DiscordUserID uint   `gorm:"uniqueIndex:idx_translation_vote"`
+	Vote          int8
+}
+
+// TranslationCorrection is a better translation suggested by a member.
+// Approved corrections replace the bot's translation of the same text in their server.
+type TranslationCorrection struct {
+	gorm.Model
+	DiscordServerID   uint   `gorm:"index"`
+	MessageID         string `gorm:"size:32;index"`
+	SuggestedByUserID uint
+	SourceLanguage    string `gorm:"size:16"`
+	TargetLanguage    string `gorm:"size:16"`
+	SourceText        string `gorm:"type:text"`
+	OriginalText      string `gorm:"type:text"`
+	CorrectedText     string `gorm:"type:text"`
+	Approved          bool
+	ApprovedByUserID  uint
+	ApprovedAt        time.Time
+}
+
+// feedbackFor returns the feedback row of a bot translation, creating it from the kept translation if needed.
+func (h *Handler) feedbackFor(messageID string) (*TranslationFeedback, error) {
+	var feedback []TranslationFeedback
+	if res := h.db.Where("message_id = ?", messageID).Limit(1).Find(&feedback); res.Error != nil {
+		return nil, res.Error
+	}
+	if len(feedback) > 0 {
+		return &feedback[0], nil
+	}
+	record := h.GetTranslationByMessage(messageID)
+	if record == nil {
+		return nil, ErrUnknownTranslation
+	}
+	f := TranslationFeedback{MessageID: messageID, DiscordServerID: record.DiscordServerID, ChannelID: record.ChannelID,
+		SourceLanguage: record.SourceLanguage, TargetLanguage: record.TargetLanguage,
+		SourceText: record.SourceText, OutputText: record.OutputText}
+	if res := h.db.Where(TranslationFeedback{MessageID: messageID}).FirstOrCreate(&f); res.Error != nil {
+		return nil, res.Error
+	}
+	return &f, nil
+}
+
+// IsTranslationMessage reports whether a message is a bot translation that can get feedback.
+func (h *Handler) IsTranslationMessage(messageID string) bool {
+	if h.GetTranslationByMessage(messageID) != nil {
+		return true
+	}
+	var count int64
+	h.db.Model(&TranslationFeedback{}).Where("message_id = ?", messageID).Count(&count)
+	return count > 0
+}
+
+// SetTranslationVote stores a user's vote on a bot translation, replacing any earlier vote.
+// A vote of 0 removes the user's vote.
+//
+// @param messageID: The bot's reply holding the translation.
+// @param userID: The voting user's ID
+// @param vote: +1, -1 or 0.
+// @return error: ErrUnknownTranslation if the message is not a kept translation.
+func (h *Handler) SetTranslationVote(messageID string, userID uint, vote int8) error {
+	feedback, err := h.feedbackFor(messageID)
+	if err != nil {
+		return err
+	}
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("message_id = ? AND discord_user_id = ?", messageID, userID).
+			Delete(&TranslationVote{}).Error; err != nil {
+			return err
+		}
+		if vote != 0 {
+			if err := tx.Create(&TranslationVote{MessageID: messageID, DiscordUserID: userID, Vote: vote}).Error; err != nil {
+				return err
+			}
+		}
+		var up, down int64
+		tx.Model(&TranslationVote{}).Where("message_id = ? AND vote > 0", messageID).Count(&up)
+		tx.Model(&TranslationVote{}).Where("message_id = ? AND vote < 0", messageID).Count(&down)
+		feedback.Upvotes, feedback.Downvotes = uint(up), uint(down)
+		return tx.Model(feedback).Select("Upvotes", "Downvotes").Updates(feedback).Error
+	})
+}
+
+// RemoveTranslationVote removes a user's vote on a bot translation if it is the given vote.
+func (h *Handler) RemoveTranslationVote(messageID string, userID uint, vote int8) error {
+	var count int64
+	h.db.Model(&TranslationVote{}).Where("message_id = ? AND discord_user_id = ? AND vote = ?", messageID, userID, vote).Count(&count)
+	if count == 0 {
+		return nil
+	}
+	return h.SetTranslationVote(messageID, userID, 0)
+}
+
+// SuggestCorrection stores a member's correction of a bot translation.
+// A trusted member's correction is approved at once.
+//
+// @param messageID: The bot's reply holding the translation.
+// @param userID: The suggesting user's ID
+// @param text: The corrected translation.
+// @param trusted: Whether the user may correct translations without approval.
+// @return *TranslationCorrection: The stored correction.
+// @return error: ErrUnknownTranslation if the message is not a kept translation.
+func (h *Handler) SuggestCorrection(messageID string, userID uint, text string, trusted bool) (*TranslationCorrection, error) {
+	feedback, err := h.feedbackFor(messageID)
+	if err != nil {
+		return nil, err
+	}
+	correction := TranslationCorrection{
+		DiscordServerID:   feedback.DiscordServerID,
+		MessageID:         messageID,
+		SuggestedByUserID: userID,
+		SourceLanguage:    feedback.SourceLanguage,
+		TargetLanguage:    feedback.TargetLanguage,
+		SourceText:        feedback.SourceText,
+		OriginalText:      feedback.OutputText,
+		CorrectedText:     strings.TrimSpace(text),
+	}
+	if trusted {
+		correction.Approved = true
+		correction.ApprovedByUserID = userID
+		correction.ApprovedAt = time.Now().UTC()
+	}
+	if res := h.db.Create(&correction); res.Error != nil {
+		return nil, res.Error
+	}
+	if trusted {
+		h.cacheCorrection(&correction)
+	}
+	return &correction, nil
+}
+
+// ApproveCorrection approves a pending correction of a server so it replaces the bot's translation.
+//
+// @param guildID: The server's ID
+// @param id: The correction's ID
+// @param adminID: The approving admin's ID
+// @return error: An error if the server has no such correction or it could not be saved.
+func (h *Handler) ApproveCorrection(guildID, id, adminID uint) error {
+	var corrections []TranslationCorrection
+	if res := h.db.Where("discord_server_id = ? AND id = ?", guildID, id).Limit(1).Find(&corrections); res.Error != nil {
+		return res.Error
+	}
+	if len(corrections) == 0 {
+		return fmt.Errorf("correction %d not found", id)
+	}
+	c := &corrections[0]
+	c.Approved, c.ApprovedByUserID, c.ApprovedAt = true, adminID, time.Now().UTC()
+	if err := h.db.Model(c).Select("Approved", "ApprovedByUserID", "ApprovedAt").Updates(c).Error; err != nil {
+		return err
+	}
+	h.cacheCorrection(c)
+	return nil
+}
+
+// loadCorrections reads the approved corrections into memory, newest last so they win, correctionsLock must be held.
+func (h *Handler) loadCorrections() {
+	if h.corrections != nil {
+		return
+	}
+	h.corrections = map[correctionKey]string{}
+	var corrections []TranslationCorrection
+	if res := h.db.Where("approved = ?", true).Order("approved_at").Find(&corrections); res.Error != nil {
+		fmt.Printf("dbStats::loadCorrections::%s\n", res.Error.Error())
+		return
+	}
+	for _, c := range corrections {
+		h.corrections[correctionKeyOf(c.DiscordServerID, c.SourceLanguage, c.TargetLanguage, c.SourceText)] = c.CorrectedText
+	}
+}
+
+func (h *Handler) cacheCorrection(c *TranslationCorrection) {
+	h.correctionsLock.Lock()
+	defer h.correctionsLock.Unlock()
+	h.loadCorrections()
+	h.corrections[correctionKeyOf(c.DiscordServerID, c.SourceLanguage, c.TargetLanguage, c.SourceText)] = c.CorrectedText
+}
+
+func correctionKeyOf(guildID uint, from, to, text string) correctionKey {
+	return correctionKey{guildID: guildID, from: from, to: to, text: strings.TrimSpace(text)}
+}
+
+// GetCorrection returns a server's approved correction of a translation of text, if it has one.
+//
+// @param guildID: The server's ID
+// @param from: The source language.
+// @param to: The target language.
+// @param text: The source text.
+// @return string: The corrected translation.
+// @return bool: Whether the server has a correction.
+func (h *Handler) GetCorrection(guildID uint, from, to, text string) (string, bool) {
+	h.correctionsLock.Lock()
+	defer h.correctionsLock.Unlock()
+	h.loadCorrections()
+	corrected, ok := h.corrections[correctionKeyOf(guildID, from, to, text)]
+	return corrected, ok
+}
+
+// GetTranslationReports returns a server's translations with the most downvotes over upvotes.
+//
+// @param guildID: The server's ID
+// @param n: The maximum number of translations to return.
+// @return []TranslationFeedback: The lowest rated translations, worst first.
+// @return error: An error if the feedback could not be read.
+func (h *Handler) GetTranslationReports(guildID uint, n int) ([]TranslationFeedback, error) {
+	var feedback []TranslationFeedback
+	if res := h.db.Where("discord_server_id = ? AND downvotes > 0", guildID).Find(&feedback); res.Error != nil {
+		return nil, res.Error
+	}
+	slices.SortFunc(feedback, func(a, b TranslationFeedback) int {
+		if c := cmp.Compare(int(b.Downvotes)-int(b.Upvotes), int(a.Downvotes)-int(a.Upvotes)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Downvotes, a.Downvotes)
+	})
+	return feedback[:min(n, len(feedback))], nil
+}
+
+// GetPendingCorrections returns a server's corrections waiting for approval, oldest first.
+func (h *Handler) GetPendingCorrections(guildID uint, n int) ([]TranslationCorrection, error) {
+	var corrections []TranslationCorrection
+	res := h.db.Where("discord_server_id = ? AND approved = ?", guildID, false).Order("id").Limit(n).Find(&corrections)
+	return corrections, res.Error
+}
+
+// TrustedRole returns the role whose members may correct a server's translations directly.
+func (h *Handler) TrustedRole(guildID uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if server := h.findServer(guildID); server != nil {
+		return server.TrustedRoleID
+	}
+	return ""
+}
+
+// SetTrustedRole sets the role whose members may correct a server's translations directly.
+//
+// @param guildID: The server's ID
+// @param roleID: The role's ID, empty for admins only.
+// @return error: An error if the server is unknown or could not be saved.
+func (h *Handler) SetTrustedRole(guildID uint, roleID string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.TrustedRoleID = roleID
+	return h.updateServer(server, "TrustedRoleID")
+}
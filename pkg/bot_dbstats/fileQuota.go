@@ -0,0 +1,131 @@
+package botdbStats
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// UserQuotaLeft describes what is left of a user's character quotas, and of their request quotas while
+// those are enforced, under the highest tier of the roles they hold. Unknown users have nothing left,
+// as in ExceedsQuotaOrBanned.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param roles: The IDs of the user's roles in the server.
+// @return string: The quotas left, e.g. "1200 characters today, 40000 characters this month".
+func (h *Handler) UserQuotaLeft(guildID, userID uint, roles []string) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	user := h.findMember(guildID, userID)
+	if user == nil {
+		return "no quota"
+	}
+	limits := effectiveLimits(h.findServer(guildID), user, roles)
+	str := fmt.Sprintf("%s today, %s this month", charsLeft(limits.DailyCharQuota, user.DailyCharsAccrued),
+		charsLeft(limits.MonthlyCharQuota, user.MonthlyCharsAccrued))
+	if h.stats.RequestQuotas {
+		str += fmt.Sprintf(", %d translations today, %d translations this month",
+			max(0, int(limits.DailyQuota)-int(user.DailyAccrued)), max(0, int(limits.MonthlyQuota)-int(user.MonthlyAccrued)))
+	}
+	return str
+}
+
+// charsLeft formats what is left of a character quota.
+func charsLeft(quota, accrued uint64) string {
+	if quota == 0 {
+		return "unlimited characters"
+	}
+	return fmt.Sprintf("%d characters", quota-min(quota, accrued))
+}
+
+// formatCharQuota formats a character quota, 0 being unlimited.
+func formatCharQuota(quota uint64) string {
+	if quota == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatUint(quota, 10)
+}
+
+// RequestQuotasEnabled reports whether users are held to their request-count quotas as well as their character quotas.
+func (h *Handler) RequestQuotasEnabled() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.stats.RequestQuotas
+}
+
+// SetRequestQuotas turns the request-count quotas on or off.
+//
+// @param enabled: Whether to enforce the users' daily and monthly request quotas.
+// @return error: An error if the setting could not be saved.
+func (h *Handler) SetRequestQuotas(enabled bool) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats.RequestQuotas = enabled
+	return h.updateStats("RequestQuotas")
+}
+
+// ChargeUserQuota adds a translation of chars billed characters to a user's daily and monthly use, checking
+// the quotas of the highest tier of the user's roles in the same store transaction so concurrent translations
+// cannot pass them.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param roles: The IDs of the user's roles in the server.
+// @param chars: The characters to be translated.
+// @return error: ErrQuotaExceeded if the user has too little quota left or is unknown.
+func (h *Handler) ChargeUserQuota(guildID, userID uint, roles []string, chars int) error {
+	if chars <= 0 {
+		return nil
+	}
+	return h.chargeUser(guildID, userID, roles, chars, 1)
+}
+
+// RefundUserQuota gives back a translation of chars characters charged for a translation that was not made.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param chars: The characters charged for the translation.
+func (h *Handler) RefundUserQuota(guildID, userID uint, chars int) {
+	if chars <= 0 {
+		return
+	}
+	if err := h.chargeUser(guildID, userID, nil, -chars, -1); err != nil {
+		fmt.Printf("dbStats::RefundUserQuota::%s\n", err.Error())
+	}
+}
+
+// chargeUser applies a charge or refund through the store and copies the stored use back.
+func (h *Handler) chargeUser(guildID, userID uint, roles []string, chars, requests int) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	user := h.findMember(guildID, userID)
+	if user == nil {
+		return ErrQuotaExceeded
+	}
+	usage, err := h.store.ChargeUser(userID, UserCharge{
+		Chars:         chars,
+		Requests:      requests,
+		CheckRequests: h.stats.RequestQuotas,
+		Limits:        effectiveLimits(h.findServer(guildID), user, roles),
+	})
+	if err != nil {
+		return err
+	}
+	user.DailyAccrued, user.MonthlyAccrued = usage.DailyAccrued, usage.MonthlyAccrued
+	user.DailyCharsAccrued, user.MonthlyCharsAccrued = usage.DailyCharsAccrued, usage.MonthlyCharsAccrued
+	return nil
+}
+
+// findMember returns a member of a server, nil if the server or member is unknown, lock must be held.
+func (h *Handler) findMember(guildID, userID uint) *DiscordUser {
+	server := h.findServer(guildID)
+	if server == nil {
+		return nil
+	}
+	for n := range server.Members {
+		if server.Members[n].ID == userID {
+			return &server.Members[n]
+		}
+	}
+	return nil
+}
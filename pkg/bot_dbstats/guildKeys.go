@@ -0,0 +1,116 @@
+package botdbStats
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+var keyCipher_ cipher.AEAD
+
+var ErrKeyEncryptionUnset = errors.New("api key encryption secret not configured")
+var ErrKeyUndecryptable = errors.New("api key can't be decrypted")
+
+// GuildAPIKey is a server's own translation provider API key, encrypted at rest.
+type GuildAPIKey struct {
+	gorm.Model
+	DiscordServerID uint `gorm:"unique"`
+	SetByUserID     uint
+	EncryptedKey    []byte // nonce followed by the AES-GCM sealed key
+}
+
+// SetKeyEncryptionSecret sets the secret used to encrypt server API keys.
+// Servers cannot register their own key until a secret is set.
+//
+// @param secret: The encryption secret from the bot credentials.
+// @return error: An error if the cipher could not be created.
+func SetKeyEncryptionSecret(secret string) error {
+	if secret == "" {
+		return ErrKeyEncryptionUnset
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+	keyCipher_, err = cipher.NewGCM(block)
+	return err
+}
+
+func encryptKey(plain string) ([]byte, error) {
+	if keyCipher_ == nil {
+		return nil, ErrKeyEncryptionUnset
+	}
+	nonce := make([]byte, keyCipher_.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return keyCipher_.Seal(nonce, nonce, []byte(plain), nil), nil
+}
+
+func decryptKey(sealed []byte) (string, error) {
+	if keyCipher_ == nil {
+		return "", ErrKeyEncryptionUnset
+	}
+	n := keyCipher_.NonceSize()
+	if len(sealed) < n {
+		return "", fmt.Errorf("%w: encrypted key too short", ErrKeyUndecryptable)
+	}
+	plain, err := keyCipher_.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrKeyUndecryptable, err)
+	}
+	return string(plain), nil
+}
+
+// SetGuildAPIKey encrypts and stores a server's own API key, replacing any previous key.
+//
+// @param guildID: The server's ID
+// @param userID: The admin registering the key.
+// @param apiKey: The plain API key.
+// @return error: An error if the key could not be encrypted or saved.
+func (h *Handler) SetGuildAPIKey(guildID, userID uint, apiKey string) error {
+	sealed, err := encryptKey(apiKey)
+	if err != nil {
+		return err
+	}
+	var key GuildAPIKey
+	if res := h.db.Where("discord_server_id = ?", guildID).Limit(1).Find(&key); res.Error != nil {
+		return res.Error
+	}
+	key.DiscordServerID = guildID
+	key.SetByUserID = userID
+	key.EncryptedKey = sealed
+	return h.db.Save(&key).Error
+}
+
+// GetGuildAPIKey returns a server's own API key, or an empty string if it has none.
+//
+// @param guildID: The server's ID
+// @return string: The plain API key.
+// @return error: An error if the key could not be read, ErrKeyUndecryptable or ErrKeyEncryptionUnset if it
+// can't be decrypted.
+func (h *Handler) GetGuildAPIKey(guildID uint) (string, error) {
+	var keys []GuildAPIKey
+	if res := h.db.Where("discord_server_id = ?", guildID).Limit(1).Find(&keys); res.Error != nil {
+		return "", res.Error
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+	return decryptKey(keys[0].EncryptedKey)
+}
+
+// RemoveGuildAPIKey deletes a server's own API key.
+//
+// @param guildID: The server's ID
+// @return error: An error if the key could not be deleted.
+func (h *Handler) RemoveGuildAPIKey(guildID uint) error {
+	return h.db.Unscoped().Where("discord_server_id = ?", guildID).Delete(&GuildAPIKey{}).Error
+}
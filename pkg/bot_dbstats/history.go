@@ -0,0 +1,174 @@
+package botdbStats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultHistoryRetentionDays = 90
+
+// recentTranslationsSize is how many translations are remembered in memory for replies to the bot,
+// whether or not their server keeps history
+const recentTranslationsSize = 500
+
+// TranslationRecord is one translation kept in a user's history.
+type TranslationRecord struct {
+	gorm.Model
+	DiscordUserID   uint   `gorm:"index"`
+	DiscordServerID uint   `gorm:"index"`
+	ChannelID       string `gorm:"size:32"`
+	MessageID       string `gorm:"size:32;index"` // The bot's reply holding the translation
+	SourceLanguage  string `gorm:"size:16"`
+	TargetLanguage  string `gorm:"size:16"`
+	SourceText      string `gorm:"type:text"`
+	OutputText      string `gorm:"type:text"`
+}
+
+// HistoryEnabled reports whether a server keeps translation history.
+func (h *Handler) HistoryEnabled(guildID uint) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	return server != nil && !server.HistoryDisabled
+}
+
+// SetHistoryEnabled turns translation history on or off for a server.
+// Turning it off also deletes the history already kept for the server.
+//
+// @param guildID: The server's ID
+// @param enabled: Whether to keep history.
+// @return error: An error if the server is unknown or could not be saved.
+func (h *Handler) SetHistoryEnabled(guildID uint, enabled bool) error {
+	h.lock.Lock()
+	server := h.findServer(guildID)
+	if server == nil {
+		h.lock.Unlock()
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.HistoryDisabled = !enabled
+	err := h.updateServer(server, "HistoryDisabled")
+	h.lock.Unlock()
+	if err != nil || enabled {
+		return err
+	}
+	return h.db.Unscoped().Where("discord_server_id = ?", guildID).Delete(&TranslationRecord{}).Error
+}
+
+// HistoryRetention returns how long translation history is kept.
+func (h *Handler) HistoryRetention() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	days := h.stats.HistoryRetentionDays
+	if days == 0 {
+		days = defaultHistoryRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// SetHistoryRetention sets how many days translation history is kept.
+//
+// @param days: The retention period in days.
+// @return error: An error if the setting could not be saved.
+func (h *Handler) SetHistoryRetention(days uint) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats.HistoryRetentionDays = days
+	return h.updateStats("HistoryRetentionDays")
+}
+
+// RecordTranslation remembers a translation for replies to the bot and adds it to its user's history
+// unless the server has history turned off.
+//
+// @param record: The translation to keep.
+func (h *Handler) RecordTranslation(record *TranslationRecord) {
+	h.recentLock.Lock()
+	if _, ok := h.recentTranslations[record.MessageID]; !ok {
+		h.recentOrder = append(h.recentOrder, record.MessageID)
+	}
+	h.recentTranslations[record.MessageID] = *record
+	if len(h.recentOrder) > recentTranslationsSize {
+		delete(h.recentTranslations, h.recentOrder[0])
+		h.recentOrder = h.recentOrder[1:]
+	}
+	h.recentLock.Unlock()
+
+	if !h.HistoryEnabled(record.DiscordServerID) {
+		return
+	}
+	if res := h.db.Create(record); res.Error != nil {
+		fmt.Printf("dbStats::RecordTranslation::%s\n", res.Error.Error())
+	}
+}
+
+// GetTranslationByMessage returns the translation a bot reply holds, or nil if none is kept.
+func (h *Handler) GetTranslationByMessage(messageID string) *TranslationRecord {
+	h.recentLock.Lock()
+	record, ok := h.recentTranslations[messageID]
+	h.recentLock.Unlock()
+	if ok {
+		return &record
+	}
+	var records []TranslationRecord
+	if res := h.db.Where("message_id = ?", messageID).Limit(1).Find(&records); res.Error != nil || len(records) == 0 {
+		return nil
+	}
+	return &records[0]
+}
+
+// GetUserHistory returns a user's most recent translations, newest first.
+//
+// @param userID: The user's ID
+// @param n: The number of translations to return.
+// @return []TranslationRecord: The translations.
+// @return error: An error if the history could not be read.
+func (h *Handler) GetUserHistory(userID uint, n int) ([]TranslationRecord, error) {
+	var records []TranslationRecord
+	res := h.db.Where("discord_user_id = ?", userID).Order("created_at desc").Limit(n).Find(&records)
+	return records, res.Error
+}
+
+// SearchUserHistory returns a user's translations whose source or output contains word, newest first.
+//
+// @param userID: The user's ID
+// @param word: The text to look for.
+// @param n: The maximum number of translations to return.
+// @return []TranslationRecord: The matching translations.
+// @return error: An error if the history could not be read.
+func (h *Handler) SearchUserHistory(userID uint, word string, n int) ([]TranslationRecord, error) {
+	// SQLite has no default LIKE escape and MySQL reads '\' in literals, so escape with '!' on every driver
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(word)
+	pattern := "%" + escaped + "%"
+	var records []TranslationRecord
+	res := h.db.Where("discord_user_id = ? AND (source_text LIKE ? ESCAPE '!' OR output_text LIKE ? ESCAPE '!')",
+		userID, pattern, pattern).
+		Order("created_at desc").Limit(n).Find(&records)
+	return records, res.Error
+}
+
+// PruneHistory deletes the translations older than the retention period.
+func (h *Handler) PruneHistory() {
+	cutoff := time.Now().UTC().Add(-h.HistoryRetention())
+	res := h.db.Unscoped().Where("created_at < ?", cutoff).Delete(&TranslationRecord{})
+	if res.Error != nil {
+		fmt.Printf("dbStats::PruneHistory::%s\n", res.Error.Error())
+		return
+	}
+	if res.RowsAffected > 0 {
+		fmt.Printf("Pruned %d history records\n", res.RowsAffected)
+	}
+}
+
+// RunHistoryPruner prunes expired history now and then every interval.
+//
+// @param interval: How often to prune.
+func (h *Handler) RunHistoryPruner(interval time.Duration) {
+	h.PruneHistory()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.PruneHistory()
+	}
+}
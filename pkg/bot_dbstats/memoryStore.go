@@ -0,0 +1,418 @@
+package botdbStats
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memoryStore keeps the stats in memory only, for tests and bots that need no database.
+type memoryStore struct {
+	lock   sync.Mutex
+	stats  *GoogleTranslateStats
+	nextID uint
+	resets []QuotaReset
+	audits []QuotaAudit
+}
+
+// NewMemoryStore returns a StatsStore that keeps everything in memory.
+//
+// @return StatsStore: The store.
+func NewMemoryStore() StatsStore {
+	return &memoryStore{}
+}
+
+// OpenMemoryDB opens an in-memory SQLite database holding the tables kept outside the stats,
+// for a NewMemoryStore handler. The database is gone once it is closed.
+//
+// @return *gorm.DB: The database.
+// @return error: An error if the database could not be created.
+func OpenMemoryDB() (*gorm.DB, error) {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to ":memory:" opens a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	if err := conn.AutoMigrate(tableModels...); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// loaded returns the kept stats, creating them on first use, ms.lock must be held.
+func (ms *memoryStore) loaded() *GoogleTranslateStats {
+	if ms.stats == nil {
+		ms.stats = newStats()
+		ms.stats.ID = 1
+	}
+	return ms.stats
+}
+
+func (ms *memoryStore) LoadStats() (*GoogleTranslateStats, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return cloneStats(ms.loaded()), nil
+}
+
+func (ms *memoryStore) SaveChanges(stats *GoogleTranslateStats, servers []DiscordServer, users []DiscordUser) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	kept := ms.loaded()
+	if stats != nil {
+		c := *stats
+		c.SymbolsTranslated = kept.SymbolsTranslated
+		c.TranslateSessions, c.BlacklistedUsers, c.Servers = kept.TranslateSessions, kept.BlacklistedUsers, kept.Servers
+		*kept = c
+	}
+	for _, server := range servers {
+		n, found := slices.BinarySearchFunc(kept.Servers, server.ID, func(a DiscordServer, b uint) int {
+			return cmp.Compare(a.ID, b)
+		})
+		if found {
+			server.Members, server.Phrasebook, server.QuotaTiers = kept.Servers[n].Members, kept.Servers[n].Phrasebook, kept.Servers[n].QuotaTiers
+			server.SymbolsUsed = kept.Servers[n].SymbolsUsed
+			kept.Servers[n] = server
+		} else {
+			server.Members, server.Phrasebook, server.QuotaTiers = nil, nil, nil
+			kept.Servers = slices.Insert(kept.Servers, n, server)
+		}
+	}
+	for _, user := range users {
+		n := slices.IndexFunc(kept.Servers, func(s DiscordServer) bool { return s.ID == user.DiscordServerID })
+		if n < 0 {
+			return fmt.Errorf("server %d of user %d not found", user.DiscordServerID, user.ID)
+		}
+		members := &kept.Servers[n].Members
+		i, found := slices.BinarySearchFunc(*members, user.ID, func(a DiscordUser, b uint) int {
+			return cmp.Compare(a.ID, b)
+		})
+		if found {
+			if err := copyFields(&user, &(*members)[i], userCounters); err != nil {
+				return err
+			}
+			(*members)[i] = user
+		} else {
+			*members = slices.Insert(*members, i, user)
+		}
+	}
+	return nil
+}
+
+func (ms *memoryStore) UpdateStats(stats *GoogleTranslateStats, fields ...string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.stats == nil {
+		ms.stats = cloneStats(stats)
+		return nil
+	}
+	return copyFields(ms.stats, stats, fields)
+}
+
+func (ms *memoryStore) UpdateServer(server *DiscordServer, fields ...string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.stats == nil {
+		return fmt.Errorf("server %d not found", server.ID)
+	}
+	n := slices.IndexFunc(ms.stats.Servers, func(s DiscordServer) bool { return s.ID == server.ID })
+	if n < 0 {
+		return fmt.Errorf("server %d not found", server.ID)
+	}
+	return copyFields(&ms.stats.Servers[n], server, fields)
+}
+
+func (ms *memoryStore) UpdateUser(user *DiscordUser, fields ...string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if kept := ms.findUser(user.ID); kept != nil {
+		return copyFields(kept, user, fields)
+	}
+	return fmt.Errorf("user %d not found", user.ID)
+}
+
+func (ms *memoryStore) UpdateUserQuotas(user *DiscordUser, fields []string, audits []QuotaAudit) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	kept := ms.findUser(user.ID)
+	if kept == nil {
+		return fmt.Errorf("user %d not found", user.ID)
+	}
+	if err := copyFields(kept, user, fields); err != nil {
+		return err
+	}
+	ms.addAudits(audits)
+	return nil
+}
+
+func (ms *memoryStore) UpdateServerQuotas(server *DiscordServer, fields []string, audits []QuotaAudit) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	n := slices.IndexFunc(ms.loaded().Servers, func(s DiscordServer) bool { return s.ID == server.ID })
+	if n < 0 {
+		return fmt.Errorf("server %d not found", server.ID)
+	}
+	if err := copyFields(&ms.stats.Servers[n], server, fields); err != nil {
+		return err
+	}
+	ms.addAudits(audits)
+	return nil
+}
+
+// addAudits keeps quota audit entries, ms.lock must be held.
+func (ms *memoryStore) addAudits(audits []QuotaAudit) {
+	now := time.Now().UTC()
+	for _, a := range audits {
+		ms.nextID++
+		a.ID, a.CreatedAt, a.UpdatedAt = ms.nextID, now, now
+		ms.audits = append(ms.audits, a)
+	}
+}
+
+func (ms *memoryStore) QuotaAudits(guildID, userID uint, n int) ([]QuotaAudit, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	var audits []QuotaAudit
+	for i := len(ms.audits) - 1; i >= 0 && len(audits) < n; i-- {
+		if a := ms.audits[i]; a.DiscordServerID == guildID && a.DiscordUserID == userID {
+			audits = append(audits, a)
+		}
+	}
+	return audits, nil
+}
+
+func (ms *memoryStore) SaveQuotaTier(tier *QuotaTier) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	n := slices.IndexFunc(ms.loaded().Servers, func(s DiscordServer) bool { return s.ID == tier.DiscordServerID })
+	if n < 0 {
+		return fmt.Errorf("server %d not found", tier.DiscordServerID)
+	}
+	tiers := &ms.stats.Servers[n].QuotaTiers
+	if i := slices.IndexFunc(*tiers, func(t QuotaTier) bool { return t.RoleID == tier.RoleID }); i >= 0 {
+		tier.ID, tier.CreatedAt = (*tiers)[i].ID, (*tiers)[i].CreatedAt
+		(*tiers)[i] = *tier
+		return nil
+	}
+	ms.nextID++
+	tier.ID = ms.nextID
+	*tiers = append(*tiers, *tier)
+	return nil
+}
+
+func (ms *memoryStore) RemoveQuotaTier(guildID uint, roleID string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if n := slices.IndexFunc(ms.loaded().Servers, func(s DiscordServer) bool { return s.ID == guildID }); n >= 0 {
+		ms.stats.Servers[n].QuotaTiers = slices.DeleteFunc(ms.stats.Servers[n].QuotaTiers, func(t QuotaTier) bool {
+			return t.RoleID == roleID
+		})
+	}
+	return nil
+}
+
+func (ms *memoryStore) AddSymbols(statsID, guildID uint, n uint64) (total, serverUsed uint64, err error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	kept := ms.loaded()
+	kept.SymbolsTranslated += n
+	if i := slices.IndexFunc(kept.Servers, func(s DiscordServer) bool { return s.ID == guildID }); i >= 0 {
+		kept.Servers[i].SymbolsUsed += n
+		serverUsed = kept.Servers[i].SymbolsUsed
+	}
+	return kept.SymbolsTranslated, serverUsed, nil
+}
+
+func (ms *memoryStore) ChargeUser(userID uint, charge UserCharge) (UserUsage, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	user := ms.findUser(userID)
+	if user == nil {
+		if charge.Chars > 0 || charge.Requests > 0 {
+			return UserUsage{}, ErrQuotaExceeded
+		}
+		return UserUsage{}, fmt.Errorf("user %d not found", userID)
+	}
+	limits := charge.Limits
+	if charge.Chars > 0 {
+		n := uint64(charge.Chars)
+		if limits.DailyCharQuota > 0 && user.DailyCharsAccrued+n > limits.DailyCharQuota ||
+			limits.MonthlyCharQuota > 0 && user.MonthlyCharsAccrued+n > limits.MonthlyCharQuota {
+			return UserUsage{}, ErrQuotaExceeded
+		}
+	}
+	if charge.Requests > 0 && charge.CheckRequests {
+		if int(user.DailyAccrued)+charge.Requests > int(limits.DailyQuota) ||
+			int(user.MonthlyAccrued)+charge.Requests > int(limits.MonthlyQuota) {
+			return UserUsage{}, ErrQuotaExceeded
+		}
+	}
+	addCounter(&user.DailyCharsAccrued, charge.Chars)
+	addCounter(&user.MonthlyCharsAccrued, charge.Chars)
+	addCounter(&user.DailyAccrued, charge.Requests)
+	addCounter(&user.MonthlyAccrued, charge.Requests)
+	return UserUsage{user.DailyAccrued, user.MonthlyAccrued, user.DailyCharsAccrued, user.MonthlyCharsAccrued}, nil
+}
+
+// addCounter adds n to a counter, a negative n takes away no more than it holds.
+func addCounter[T uint16 | uint64](counter *T, n int) {
+	if n >= 0 {
+		*counter += T(n)
+	} else {
+		*counter -= min(*counter, T(-n))
+	}
+}
+
+func (ms *memoryStore) AddTranslates(userID uint, n uint64) (uint64, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	user := ms.findUser(userID)
+	if user == nil {
+		return 0, fmt.Errorf("user %d not found", userID)
+	}
+	user.NumOfTranslates += n
+	return user.NumOfTranslates, nil
+}
+
+// findUser returns a kept user, ms.lock must be held.
+func (ms *memoryStore) findUser(userID uint) *DiscordUser {
+	if ms.stats == nil {
+		return nil
+	}
+	for i := range ms.stats.Servers {
+		members := ms.stats.Servers[i].Members
+		if n := slices.IndexFunc(members, func(u DiscordUser) bool { return u.ID == userID }); n >= 0 {
+			return &members[n]
+		}
+	}
+	return nil
+}
+
+func (ms *memoryStore) ResetUserUsage(kind string, guildID uint, periodStart time.Time, fields ...string) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if slices.ContainsFunc(ms.resets, func(r QuotaReset) bool {
+		return r.Kind == kind && r.DiscordServerID == guildID && r.PeriodStart.Equal(periodStart)
+	}) {
+		return false, nil
+	}
+	reset := QuotaReset{DiscordServerID: guildID, Kind: kind, PeriodStart: periodStart}
+	kept := ms.loaded()
+	var zero DiscordUser
+	for i := range kept.Servers {
+		if kept.Servers[i].ID != guildID {
+			continue
+		}
+		for j := range kept.Servers[i].Members {
+			u := &kept.Servers[i].Members[j]
+			if anyNonZero(u, fields) {
+				reset.UsersReset++
+			}
+			if err := copyFields(u, &zero, fields); err != nil {
+				return false, err
+			}
+		}
+	}
+	ms.nextID++
+	reset.ID = ms.nextID
+	reset.CreatedAt = time.Now().UTC()
+	ms.resets = append(ms.resets, reset)
+	return true, nil
+}
+
+func (ms *memoryStore) LastQuotaReset(kind string, guildID uint) (time.Time, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	var last time.Time
+	for _, r := range ms.resets {
+		if r.Kind == kind && r.DiscordServerID == guildID && r.PeriodStart.After(last) {
+			last = r.PeriodStart
+		}
+	}
+	return last, nil
+}
+
+func (ms *memoryStore) AddBlacklisted(entry *BlacklistedUser) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.loaded()
+	if slices.ContainsFunc(ms.stats.BlacklistedUsers, func(b BlacklistedUser) bool { return b.UserID == entry.UserID }) {
+		return fmt.Errorf("user %d is already blacklisted", entry.UserID)
+	}
+	ms.nextID++
+	entry.ID = ms.nextID
+	ms.stats.BlacklistedUsers = append(ms.stats.BlacklistedUsers, *entry)
+	return nil
+}
+
+func (ms *memoryStore) RemoveBlacklisted(userID uint) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.stats != nil {
+		ms.stats.BlacklistedUsers = slices.DeleteFunc(ms.stats.BlacklistedUsers, func(b BlacklistedUser) bool { return b.UserID == userID })
+	}
+	return nil
+}
+
+func (ms *memoryStore) BlacklistedSince(t time.Time) ([]BlacklistedUser, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	var banned []BlacklistedUser
+	if ms.stats != nil {
+		for _, b := range ms.stats.BlacklistedUsers {
+			if !b.StartBanDateTime.Before(t) {
+				banned = append(banned, b)
+			}
+		}
+	}
+	return banned, nil
+}
+
+// cloneStats copies stats with their servers, members and blacklist so the copy shares no slices.
+func cloneStats(stats *GoogleTranslateStats) *GoogleTranslateStats {
+	c := *stats
+	c.TranslateSessions = slices.Clone(stats.TranslateSessions)
+	c.BlacklistedUsers = slices.Clone(stats.BlacklistedUsers)
+	c.Servers = slices.Clone(stats.Servers)
+	for i := range c.Servers {
+		c.Servers[i].Members = slices.Clone(c.Servers[i].Members)
+		c.Servers[i].Phrasebook = slices.Clone(c.Servers[i].Phrasebook)
+		c.Servers[i].QuotaTiers = slices.Clone(c.Servers[i].QuotaTiers)
+	}
+	return &c
+}
+
+// anyNonZero reports whether any of the named fields of v is set.
+func anyNonZero(v any, fields []string) bool {
+	r := reflect.ValueOf(v).Elem()
+	for _, name := range fields {
+		if field := r.FieldByName(name); field.IsValid() && !field.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFields sets the named fields of dst to their values in src, both pointers to the same struct type.
+func copyFields(dst, src any, fields []string) error {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, name := range fields {
+		field := d.FieldByName(name)
+		if !field.IsValid() {
+			return fmt.Errorf("unknown field %s", name)
+		}
+		field.Set(s.FieldByName(name))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package botdbStats
+
+import (
+	"slices"
+
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// PartnerOptIn records that a user wants to be matched with a language exchange partner.
+type PartnerOptIn struct {
+	gorm.Model
+	DiscordServerID uint `gorm:"uniqueIndex:idx_partner_opt_in"`
+	DiscordUserID   uint `gorm:"uniqueIndex:idx_partner_opt_in"`
+	Active          bool
+}
+
+// PartnerMatch is a language exchange pairing of two users, stored with the lower user ID first.
+type PartnerMatch struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"index"`
+	UserAID         uint   `gorm:"index"`
+	UserBID         uint   `gorm:"index"`
+	LanguageA       string `gorm:"size:16"` // The language UserA translates from, which UserB translates to
+	LanguageB       string `gorm:"size:16"` // The language UserB translates from, which UserA translates to
+}
+
+// PartnerCandidate is a user whose language directions complement another user's.
+type PartnerCandidate struct {
+	User     DiscordUser
+	FromLang string // The language the searching user translates from and the candidate translates to
+	ToLang   string // The language the searching user translates to and the candidate translates from
+}
+
+// SetPartnerOptIn opts a user in or out of partner matching in a server.
+func (h *Handler) SetPartnerOptIn(guildID, userID uint, active bool) error {
+	optIn := PartnerOptIn{DiscordServerID: guildID, DiscordUserID: userID}
+	if res := h.db.Where(optIn).FirstOrCreate(&optIn); res.Error != nil {
+		return res.Error
+	}
+	return h.db.Model(&optIn).Update("active", active).Error
+}
+
+// IsPartnerOptedIn reports whether a user opted in to partner matching in a server.
+func (h *Handler) IsPartnerOptedIn(guildID, userID uint) bool {
+	var count int64
+	h.db.Model(&PartnerOptIn{}).Where("discord_server_id = ? AND discord_user_id = ? AND active = ?", guildID, userID, true).Count(&count)
+	return count > 0
+}
+
+// baseLanguages returns the base languages of tags, so 'en-US' and 'en' match.
+func baseLanguages(tags []string) []string {
+	var bases []string
+	for _, t := range tags {
+		tag, err := language.Parse(t)
+		if err != nil {
+			continue
+		}
+		base, _ := tag.Base()
+		if !slices.Contains(bases, base.String()) {
+			bases = append(bases, base.String())
+		}
+	}
+	return bases
+}
+
+// complementaryPair returns a language user translates from that other translates to,
+// and a different language other translates from that user translates to.
+func complementaryPair(user, other *DiscordUser) (string, string, bool) {
+	userFrom, userTo := baseLanguages(user.LangStats.GetFromAsSlice()), baseLanguages(user.LangStats.GetToAsSlice())
+	otherFrom, otherTo := baseLanguages(other.LangStats.GetFromAsSlice()), baseLanguages(other.LangStats.GetToAsSlice())
+	for _, from := range userFrom {
+		if !slices.Contains(otherTo, from) {
+			continue
+		}
+		for _, to := range userTo {
+			if to != from && slices.Contains(otherFrom, to) {
+				return from, to, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// FindPartner returns an opted in member of the user's server whose language directions complement the user's,
+// skipping users the user was already matched with. The most recently active candidate is returned.
+//
+// @param guildID: The server's ID
+// @param userID: The searching user's ID
+// @return *PartnerCandidate: The partner, nil if no member matches.
+// @return error: An error if the opt ins or previous matches could not be read.
+func (h *Handler) FindPartner(guildID, userID uint) (*PartnerCandidate, error) {
+	var optIns []PartnerOptIn
+	if res := h.db.Where("discord_server_id = ? AND active = ? AND discord_user_id <> ?", guildID, true, userID).Find(&optIns); res.Error != nil {
+		return nil, res.Error
+	}
+	var matches []PartnerMatch
+	if res := h.db.Where("user_a_id = ? OR user_b_id = ?", userID, userID).Find(&matches); res.Error != nil {
+		return nil, res.Error
+	}
+	matched := map[uint]bool{}
+	for _, m := range matches {
+		matched[m.UserAID], matched[m.UserBID] = true, true
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return nil, nil
+	}
+	userIdx := slices.IndexFunc(server.Members, func(u DiscordUser) bool { return u.ID == userID })
+	if userIdx < 0 {
+		return nil, nil
+	}
+	var best *PartnerCandidate
+	for _, optIn := range optIns {
+		if matched[optIn.DiscordUserID] {
+			continue
+		}
+		n := slices.IndexFunc(server.Members, func(u DiscordUser) bool { return u.ID == optIn.DiscordUserID })
+		if n < 0 {
+			continue
+		}
+		from, to, ok := complementaryPair(&server.Members[userIdx], &server.Members[n])
+		if !ok {
+			continue
+		}
+		if best == nil || server.Members[n].LastTranslateUse.After(best.User.LastTranslateUse) {
+			best = &PartnerCandidate{User: server.Members[n], FromLang: from, ToLang: to}
+		}
+	}
+	return best, nil
+}
+
+// RecordPartnerMatch stores a pairing so the two users are not matched again.
+//
+// @param guildID: The server's ID
+// @param userID: The searching user's ID
+// @param partner: The partner found for the user.
+// @return error: An error if the match could not be saved.
+func (h *Handler) RecordPartnerMatch(guildID, userID uint, partner *PartnerCandidate) error {
+	match := PartnerMatch{DiscordServerID: guildID, UserAID: userID, UserBID: partner.User.ID,
+		LanguageA: partner.FromLang, LanguageB: partner.ToLang}
+	if match.UserAID > match.UserBID {
+		match.UserAID, match.UserBID = match.UserBID, match.UserAID
+		match.LanguageA, match.LanguageB = match.LanguageB, match.LanguageA
+	}
+	return h.db.Create(&match).Error
+}
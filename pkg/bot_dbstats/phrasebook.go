@@ -0,0 +1,80 @@
+package botdbStats
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrPhraseExists = errors.New("phrase already in the phrasebook")
+
+// PhrasebookEntry is a translation saved to a server's shared phrasebook.
+type PhrasebookEntry struct {
+	gorm.Model
+	DiscordServerID uint `gorm:"index"` // Foreign key referencing the ID field from DiscordServer
+	SavedByUserID   uint
+	SourceLanguage  string `gorm:"size:16"`
+	TargetLanguage  string `gorm:"size:16"`
+	SourceText      string `gorm:"type:text"`
+	TranslatedText  string `gorm:"type:text"`
+}
+
+// SavePhrase adds a translation to its server's phrasebook.
+//
+// @param entry: The phrase to save.
+// @return error: ErrPhraseExists if the server already saved the same translation.
+func (h *Handler) SavePhrase(entry *PhrasebookEntry) error {
+	var count int64
+	h.db.Model(&PhrasebookEntry{}).
+		Where("discord_server_id = ? AND source_language = ? AND target_language = ? AND source_text = ? AND translated_text = ?",
+			entry.DiscordServerID, entry.SourceLanguage, entry.TargetLanguage, entry.SourceText, entry.TranslatedText).
+		Count(&count)
+	if count > 0 {
+		return ErrPhraseExists
+	}
+	return h.db.Create(entry).Error
+}
+
+// GetPhrasebook returns a server's phrasebook, oldest first.
+// If lang is not empty only phrases translated from or to lang are returned.
+//
+// @param guildID: The server's ID
+// @param lang: The language to filter by, or empty for all.
+// @return []PhrasebookEntry: The phrases.
+// @return error: An error if the phrasebook could not be read.
+func (h *Handler) GetPhrasebook(guildID uint, lang string) ([]PhrasebookEntry, error) {
+	var entries []PhrasebookEntry
+	query := h.db.Where("discord_server_id = ?", guildID)
+	if lang != "" {
+		query = query.Where("source_language = ? OR target_language = ?", lang, lang)
+	}
+	res := query.Order("id").Find(&entries)
+	return entries, res.Error
+}
+
+// GetPhrase returns a phrase of a server's phrasebook.
+//
+// @param guildID: The server's ID
+// @param id: The phrase's ID
+// @return *PhrasebookEntry: The phrase, nil if the server has no such phrase.
+func (h *Handler) GetPhrase(guildID, id uint) *PhrasebookEntry {
+	var entries []PhrasebookEntry
+	if res := h.db.Where("discord_server_id = ? AND id = ?", guildID, id).Limit(1).Find(&entries); res.Error != nil || len(entries) == 0 {
+		return nil
+	}
+	return &entries[0]
+}
+
+// RemovePhrase deletes a phrase from a server's phrasebook.
+//
+// @param guildID: The server's ID
+// @param id: The phrase's ID
+// @return error: An error if the phrase could not be deleted.
+func (h *Handler) RemovePhrase(guildID, id uint) error {
+	res := h.db.Where("discord_server_id = ? AND id = ?", guildID, id).Delete(&PhrasebookEntry{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return fmt.Errorf("phrase %d not found", id)
+	}
+	return res.Error
+}
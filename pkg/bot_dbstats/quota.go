@@ -0,0 +1,353 @@
+package botdbStats
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"gorm.io/gorm"
+)
+
+// Actions of a QuotaAudit
+const (
+	QuotaActionSet     = "set"
+	QuotaActionReset   = "reset"
+	QuotaActionDefault = "default"
+)
+
+// quotaAuditShown is how many recent changes <quota show> lists
+const quotaAuditShown = 5
+
+// QuotaAudit records one change an admin made to a user's quota or a server's default quota.
+type QuotaAudit struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"index"`
+	DiscordUserID   uint   `gorm:"index"` // The user changed, 0 for a server default
+	ActorID         uint   // The admin who made the change
+	Action          string `gorm:"size:16"` // QuotaActionSet, QuotaActionReset or QuotaActionDefault
+	Field           string `gorm:"size:32"` // The quota or usage field changed
+	OldValue        uint64
+	NewValue        uint64
+}
+
+// quotaSetting names a quota in the quota command, the user field holding it and the server field of its default.
+type quotaSetting struct {
+	name        string
+	userField   string
+	serverField string
+	max         uint64
+	botDefault  func() uint64
+}
+
+var quotaSettings = []quotaSetting{
+	{"daily", "DailyQuota", "DefaultDailyQuota", math.MaxUint16, func() uint64 { return uint64(userDailyQuota) }},
+	{"monthly", "MonthlyQuota", "DefaultMonthlyQuota", math.MaxUint16, func() uint64 { return uint64(userMonthlyQuota) }},
+	{"dailychars", "DailyCharQuota", "DefaultDailyCharQuota", math.MaxUint64, func() uint64 { return uint64(userDailyCharQuota) }},
+	{"monthlychars", "MonthlyCharQuota", "DefaultMonthlyCharQuota", math.MaxUint64, func() uint64 { return uint64(userMonthlyCharQuota) }},
+}
+
+// usageFields are the user fields <quota reset> clears
+var usageFields = []string{"DailyAccrued", "MonthlyAccrued", "DailyCharsAccrued", "MonthlyCharsAccrued"}
+
+// findQuotaSetting returns the quota of a name used in the quota command.
+func findQuotaSetting(name string) (quotaSetting, error) {
+	for _, q := range quotaSettings {
+		if q.name == name {
+			return q, nil
+		}
+	}
+	return quotaSetting{}, fmt.Errorf("unknown quota '%s', use daily, monthly, dailychars or monthlychars", name)
+}
+
+// fieldUint returns an unsigned integer field of a struct pointer by name.
+func fieldUint(v any, name string) uint64 {
+	return reflect.ValueOf(v).Elem().FieldByName(name).Uint()
+}
+
+// setFieldUint sets an unsigned integer field of a struct pointer by name.
+func setFieldUint(v any, name string, value uint64) {
+	reflect.ValueOf(v).Elem().FieldByName(name).SetUint(value)
+}
+
+// applyDefaultQuotas gives a new member their server's default quotas, lock must be held.
+func applyDefaultQuotas(server *DiscordServer, user *DiscordUser) {
+	for _, q := range quotaSettings {
+		value := fieldUint(server, q.serverField)
+		if value == 0 {
+			value = q.botDefault()
+		}
+		setFieldUint(user, q.userField, value)
+	}
+}
+
+// SetUserQuota sets one of a user's quotas and records the change.
+//
+// @param guildID: The server's ID
+// @param actorID: The admin making the change.
+// @param userID: The user's ID
+// @param name: The quota, daily, monthly, dailychars or monthlychars.
+// @param value: The new quota, 0 is unlimited for character quotas.
+// @return error: An error if the quota, value or user is unknown or the change could not be saved.
+func (h *Handler) SetUserQuota(guildID, actorID, userID uint, name string, value uint64) error {
+	q, err := findQuotaSetting(name)
+	if err != nil {
+		return err
+	}
+	if value > q.max {
+		return fmt.Errorf("the %s quota can be at most %d", name, q.max)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	user := h.findMember(guildID, userID)
+	if user == nil {
+		return fmt.Errorf("user %d is not a member of this server", userID)
+	}
+	audit := QuotaAudit{DiscordServerID: guildID, DiscordUserID: userID, ActorID: actorID, Action: QuotaActionSet,
+		Field: q.userField, OldValue: fieldUint(user, q.userField), NewValue: value}
+	changed := *user
+	setFieldUint(&changed, q.userField, value)
+	if err := h.store.UpdateUserQuotas(&changed, []string{q.userField}, []QuotaAudit{audit}); err != nil {
+		return err
+	}
+	setFieldUint(user, q.userField, value)
+	h.markUserDirty(userID)
+	return nil
+}
+
+// ResetUserQuota clears a user's daily and monthly use and records the change.
+//
+// @param guildID: The server's ID
+// @param actorID: The admin making the change.
+// @param userID: The user's ID
+// @return error: An error if the user is unknown or the change could not be saved.
+func (h *Handler) ResetUserQuota(guildID, actorID, userID uint) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	user := h.findMember(guildID, userID)
+	if user == nil {
+		return fmt.Errorf("user %d is not a member of this server", userID)
+	}
+	var audits []QuotaAudit
+	for _, field := range usageFields {
+		audits = append(audits, QuotaAudit{DiscordServerID: guildID, DiscordUserID: userID, ActorID: actorID,
+			Action: QuotaActionReset, Field: field, OldValue: fieldUint(user, field)})
+	}
+	changed := *user
+	var zero DiscordUser
+	if err := copyFields(&changed, &zero, usageFields); err != nil {
+		return err
+	}
+	if err := h.store.UpdateUserQuotas(&changed, usageFields, audits); err != nil {
+		return err
+	}
+	return copyFields(user, &zero, usageFields)
+}
+
+// SetDefaultQuota sets the quota new members of a server get and records the change.
+// Members who already translated keep their quotas.
+//
+// @param guildID: The server's ID
+// @param actorID: The admin making the change.
+// @param name: The quota, daily, monthly, dailychars or monthlychars.
+// @param value: The new default, 0 uses the bot's default.
+// @return error: An error if the quota, value or server is unknown or the change could not be saved.
+func (h *Handler) SetDefaultQuota(guildID, actorID uint, name string, value uint64) error {
+	q, err := findQuotaSetting(name)
+	if err != nil {
+		return err
+	}
+	if value > q.max {
+		return fmt.Errorf("the %s quota can be at most %d", name, q.max)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	audit := QuotaAudit{DiscordServerID: guildID, ActorID: actorID, Action: QuotaActionDefault,
+		Field: q.serverField, OldValue: fieldUint(server, q.serverField), NewValue: value}
+	changed := *server
+	setFieldUint(&changed, q.serverField, value)
+	if err := h.store.UpdateServerQuotas(&changed, []string{q.serverField}, []QuotaAudit{audit}); err != nil {
+		return err
+	}
+	setFieldUint(server, q.serverField, value)
+	h.markServerDirty(guildID)
+	return nil
+}
+
+// FormatUserQuota returns a user's quotas, what is left of them and their latest changes, one per line.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param roles: The IDs of the user's roles in the server.
+// @return string: The formatted quota.
+func (h *Handler) FormatUserQuota(guildID, userID uint, roles []string) string {
+	h.lock.Lock()
+	user := h.findMember(guildID, userID)
+	if user == nil {
+		h.lock.Unlock()
+		return fmt.Sprintf("<@%d> has not translated in this server yet.", userID)
+	}
+	u := *user
+	own := userLimits(user)
+	limits := effectiveLimits(h.findServer(guildID), user, roles)
+	requests := "off"
+	if h.stats.RequestQuotas {
+		requests = "on"
+	}
+	h.lock.Unlock()
+
+	str := fmt.Sprintf("Quota of <@%d>\n", userID)
+	str += fmt.Sprintf("Daily characters: %d of %s\n", u.DailyCharsAccrued, formatCharQuota(limits.DailyCharQuota))
+	str += fmt.Sprintf("Monthly characters: %d of %s\n", u.MonthlyCharsAccrued, formatCharQuota(limits.MonthlyCharQuota))
+	str += fmt.Sprintf("Daily translations: %d of %d\n", u.DailyAccrued, limits.DailyQuota)
+	str += fmt.Sprintf("Monthly translations: %d of %d\n", u.MonthlyAccrued, limits.MonthlyQuota)
+	str += fmt.Sprintf("Translation quotas enforced: %s\n", requests)
+	if limits != own {
+		str += fmt.Sprintf("From a role tier, own quota: %s\n", formatLimits(own))
+	}
+	str += fmt.Sprintf("Left: %s\n", h.UserQuotaLeft(guildID, userID, roles))
+
+	audits, err := h.store.QuotaAudits(guildID, userID, quotaAuditShown)
+	if err != nil {
+		fmt.Printf("dbStats::FormatUserQuota::%s\n", err.Error())
+	}
+	if len(audits) > 0 {
+		str += "Recent changes:\n"
+	}
+	for _, a := range audits {
+		str += fmt.Sprintf("%s %s %s by <@%d>: %d → %d\n", a.CreatedAt.Format(time.DateTime), a.Action, a.Field,
+			a.ActorID, a.OldValue, a.NewValue)
+	}
+	return str
+}
+
+// FormatDefaultQuotas returns the quotas new members of a server get, one per line.
+func (h *Handler) FormatDefaultQuotas(guildID uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return "This server is not known yet."
+	}
+	var user DiscordUser
+	applyDefaultQuotas(server, &user)
+	str := "Quotas of new members\n"
+	for _, q := range quotaSettings {
+		value := fieldUint(&user, q.userField)
+		if q.max == math.MaxUint64 {
+			str += fmt.Sprintf("%s: %s\n", q.name, formatCharQuota(value))
+		} else {
+			str += fmt.Sprintf("%s: %d\n", q.name, value)
+		}
+	}
+	return str
+}
+
+// parseUserMention returns the ID of a user mentioned as '<@123>' or '<@!123>'.
+func parseUserMention(arg string) (uint, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(arg, "<@"), "!"), ">")
+	n, err := strconv.ParseUint(id, 10, 64)
+	return uint(n), err == nil
+}
+
+// memberRoles returns the roles a user holds in the server of a message.
+func memberRoles(s *discordgo.Session, m *discordgo.MessageCreate, userID uint) []string {
+	if m.Member != nil && m.Author != nil && m.Author.ID == strconv.FormatUint(uint64(userID), 10) {
+		return m.Member.Roles
+	}
+	return botUtils.MemberRoles(s, m.GuildID, strconv.FormatUint(uint64(userID), 10))
+}
+
+// mentionedName returns the name of a user mentioned in a message, or an empty string if they are not mentioned.
+func mentionedName(m *discordgo.MessageCreate, userID uint) string {
+	for _, user := range m.Mentions {
+		if user.ID == strconv.FormatUint(uint64(userID), 10) {
+			return user.Username
+		}
+	}
+	return ""
+}
+
+func (h *Handler) handleQuotaCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'quota' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	usage := "Usage: <quota show [@user]>, <quota set @user daily|monthly|dailychars|monthlychars <n>>, " +
+		"<quota reset @user> or <quota default [daily|monthly|dailychars|monthlychars <n>]>"
+	args := botUtils.GetCmdArgs(m.Content, "quota")
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+	if args[0] == "show" && len(args) == 1 {
+		s.ChannelMessageSend(m.ChannelID, h.FormatUserQuota(uint(guildID), uint(authorID), memberRoles(s, m, uint(authorID))))
+		return
+	}
+	if !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+
+	var err error
+	reply := ""
+	switch {
+	case args[0] == "show" && len(args) == 2:
+		userID, ok := parseUserMention(args[1])
+		if !ok {
+			s.ChannelMessageSend(m.ChannelID, usage)
+			return
+		}
+		reply = h.FormatUserQuota(uint(guildID), userID, memberRoles(s, m, userID))
+	case args[0] == "set" && len(args) == 4:
+		userID, ok := parseUserMention(args[1])
+		if !ok {
+			s.ChannelMessageSend(m.ChannelID, usage)
+			return
+		}
+		var value uint64
+		if value, err = strconv.ParseUint(args[3], 10, 64); err == nil {
+			err = h.EnsureMember(uint(guildID), userID, mentionedName(m, userID))
+		}
+		if err == nil {
+			err = h.SetUserQuota(uint(guildID), uint(authorID), userID, args[2], value)
+		}
+		reply = h.FormatUserQuota(uint(guildID), userID, memberRoles(s, m, userID))
+	case args[0] == "reset" && len(args) == 2:
+		userID, ok := parseUserMention(args[1])
+		if !ok {
+			s.ChannelMessageSend(m.ChannelID, usage)
+			return
+		}
+		if err = h.EnsureMember(uint(guildID), userID, mentionedName(m, userID)); err == nil {
+			err = h.ResetUserQuota(uint(guildID), uint(authorID), userID)
+		}
+		reply = h.FormatUserQuota(uint(guildID), userID, memberRoles(s, m, userID))
+	case args[0] == "default" && len(args) == 1:
+		reply = h.FormatDefaultQuotas(uint(guildID))
+	case args[0] == "default" && len(args) == 3:
+		var value uint64
+		if value, err = strconv.ParseUint(args[2], 10, 64); err == nil {
+			err = h.SetDefaultQuota(uint(guildID), uint(authorID), args[1], value)
+		}
+		reply = h.FormatDefaultQuotas(uint(guildID))
+	default:
+		s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to update the quota: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, reply)
+	fmt.Println("End Cmd")
+}
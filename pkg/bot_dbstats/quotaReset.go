@@ -0,0 +1,127 @@
+package botdbStats
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of user quota resets
+const (
+	QuotaResetDaily   = "daily"
+	QuotaResetMonthly = "monthly"
+)
+
+// QuotaReset records a reset of a server's users' daily or monthly use.
+// A reset made late after downtime has a CreatedAt after its PeriodStart.
+type QuotaReset struct {
+	gorm.Model
+	DiscordServerID uint      `gorm:"uniqueIndex:idx_quota_reset_period"`
+	Kind            string    `gorm:"size:16;uniqueIndex:idx_quota_reset_period"` // QuotaResetDaily or QuotaResetMonthly
+	PeriodStart     time.Time `gorm:"uniqueIndex:idx_quota_reset_period"`         // The boundary the reset starts the period at
+	UsersReset      int64     // Users that had use to clear
+}
+
+// quotaResetKind is a quota period and the user fields cleared when it starts.
+type quotaResetKind struct {
+	kind     string
+	fields   []string
+	boundary func(now time.Time, loc *time.Location) time.Time // The start of the period now is in, at midnight in loc
+}
+
+var quotaResetKinds = []quotaResetKind{
+	{kind: QuotaResetDaily, fields: []string{"DailyAccrued", "DailyCharsAccrued"}, boundary: func(now time.Time, loc *time.Location) time.Time {
+		local := now.In(loc)
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).UTC()
+	}},
+	{kind: QuotaResetMonthly, fields: []string{"MonthlyAccrued", "MonthlyCharsAccrued"}, boundary: func(now time.Time, loc *time.Location) time.Time {
+		local := now.In(loc)
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc).UTC()
+	}},
+}
+
+// quotaResetKey identifies the resets of one kind in one server.
+type quotaResetKey struct {
+	guildID uint
+	kind    string
+}
+
+// ResetQuotasIfDue clears each server's users' daily and monthly use for each period that started,
+// in the server's time zone, since its last recorded reset. Missed periods are caught up with one reset
+// for the latest period.
+func (h *Handler) ResetQuotasIfDue() {
+	h.quotaResetsLock.Lock()
+	defer h.quotaResetsLock.Unlock()
+	type serverZone struct {
+		id  uint
+		loc *time.Location
+	}
+	h.lock.Lock()
+	servers := make([]serverZone, 0, len(h.stats.Servers))
+	for i := range h.stats.Servers {
+		servers = append(servers, serverZone{id: h.stats.Servers[i].ID, loc: h.stats.Servers[i].Location()})
+	}
+	h.lock.Unlock()
+
+	now := time.Now()
+	for _, server := range servers {
+		for _, k := range quotaResetKinds {
+			periodStart := k.boundary(now, server.loc)
+			key := quotaResetKey{guildID: server.id, kind: k.kind}
+			last, cached := h.lastQuotaResets[key]
+			if !cached {
+				var err error
+				if last, err = h.store.LastQuotaReset(k.kind, server.id); err != nil {
+					fmt.Printf("dbStats::ResetQuotasIfDue::%s\n", err.Error())
+					continue
+				}
+				h.lastQuotaResets[key] = last
+			}
+			if !last.Before(periodStart) {
+				continue
+			}
+			if err := h.resetUserQuotas(k, server.id, periodStart); err != nil {
+				fmt.Printf("dbStats::ResetQuotasIfDue::%s\n", err.Error())
+				continue
+			}
+			h.lastQuotaResets[key] = periodStart
+		}
+	}
+}
+
+// resetUserQuotas clears the fields of a reset kind for a server's users in the store and in memory.
+// When another bot process already made the reset only the copies in memory are cleared, a charge made
+// since then is read back from the store with the user's next charge.
+func (h *Handler) resetUserQuotas(k quotaResetKind, guildID uint, periodStart time.Time) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	reset, err := h.store.ResetUserUsage(k.kind, guildID, periodStart, k.fields...)
+	if err != nil {
+		return err
+	}
+	if server := h.findServer(guildID); server != nil {
+		var zero DiscordUser
+		for i := range server.Members {
+			if err := copyFields(&server.Members[i], &zero, k.fields); err != nil {
+				return err
+			}
+		}
+	}
+	if reset {
+		fmt.Printf("Reset %s quotas of server %d for the period starting %s\n", k.kind, guildID, periodStart.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// RunQuotaResets makes due quota resets now and then checks again every interval.
+//
+// @param interval: How often to check for a new period.
+func (h *Handler) RunQuotaResets(interval time.Duration) {
+	h.ResetQuotasIfDue()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.ResetQuotasIfDue()
+	}
+}
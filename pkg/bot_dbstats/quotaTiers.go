@@ -0,0 +1,208 @@
+package botdbStats
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"gorm.io/gorm"
+)
+
+// QuotaLimits are the daily and monthly quotas a user is held to.
+type QuotaLimits struct {
+	DailyQuota       uint16 // Requests per day
+	MonthlyQuota     uint16 // Requests per month
+	DailyCharQuota   uint64 // Characters per day, 0 is unlimited
+	MonthlyCharQuota uint64 // Characters per month, 0 is unlimited
+}
+
+// QuotaTier gives the members of a role their own quotas in a server.
+type QuotaTier struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"uniqueIndex:idx_quota_tier_role"`
+	RoleID          string `gorm:"size:32;uniqueIndex:idx_quota_tier_role"`
+	QuotaLimits     `gorm:"embedded"`
+}
+
+// userLimits returns the quotas set on a user.
+func userLimits(user *DiscordUser) QuotaLimits {
+	return QuotaLimits{
+		DailyQuota:       user.DailyQuota,
+		MonthlyQuota:     user.MonthlyQuota,
+		DailyCharQuota:   user.DailyCharQuota,
+		MonthlyCharQuota: user.MonthlyCharQuota,
+	}
+}
+
+// unlimited maps a character quota of 0 above every other quota.
+func unlimited(quota uint64) uint64 {
+	if quota == 0 {
+		return math.MaxUint64
+	}
+	return quota
+}
+
+// compare orders limits by their monthly then daily character quotas, then their monthly and daily requests.
+func (l QuotaLimits) compare(o QuotaLimits) int {
+	if c := cmp.Compare(unlimited(l.MonthlyCharQuota), unlimited(o.MonthlyCharQuota)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(unlimited(l.DailyCharQuota), unlimited(o.DailyCharQuota)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(l.MonthlyQuota, o.MonthlyQuota); c != 0 {
+		return c
+	}
+	return cmp.Compare(l.DailyQuota, o.DailyQuota)
+}
+
+// charsUsed reports whether a user has used up a daily or monthly character quota of the limits.
+func (l QuotaLimits) charsUsed(user *DiscordUser) bool {
+	return l.DailyCharQuota > 0 && user.DailyCharsAccrued >= l.DailyCharQuota ||
+		l.MonthlyCharQuota > 0 && user.MonthlyCharsAccrued >= l.MonthlyCharQuota
+}
+
+// requestsUsed reports whether a user has used up a daily or monthly request quota of the limits.
+func (l QuotaLimits) requestsUsed(user *DiscordUser) bool {
+	return user.DailyAccrued >= l.DailyQuota || user.MonthlyAccrued >= l.MonthlyQuota
+}
+
+// effectiveLimits returns the highest of a user's own quotas and the tiers of the roles they hold, lock must be held.
+func effectiveLimits(server *DiscordServer, user *DiscordUser, roles []string) QuotaLimits {
+	best := userLimits(user)
+	for _, tier := range server.QuotaTiers {
+		if slices.Contains(roles, tier.RoleID) && tier.QuotaLimits.compare(best) > 0 {
+			best = tier.QuotaLimits
+		}
+	}
+	return best
+}
+
+// SetQuotaTier gives the members of a role a server's quota tier, replacing the role's tier if it has one.
+//
+// @param guildID: The server's ID
+// @param roleID: The role's ID
+// @param limits: The tier's quotas.
+// @return error: An error if the server is unknown or the tier could not be saved.
+func (h *Handler) SetQuotaTier(guildID uint, roleID string, limits QuotaLimits) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	tier := QuotaTier{DiscordServerID: guildID, RoleID: roleID, QuotaLimits: limits}
+	if err := h.store.SaveQuotaTier(&tier); err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(server.QuotaTiers, func(t QuotaTier) bool { return t.RoleID == roleID }); i >= 0 {
+		server.QuotaTiers[i].QuotaLimits = limits
+	} else {
+		server.QuotaTiers = append(server.QuotaTiers, tier)
+	}
+	return nil
+}
+
+// RemoveQuotaTier takes a role's quota tier away in a server.
+//
+// @param guildID: The server's ID
+// @param roleID: The role's ID
+// @return error: An error if the server or tier is unknown or the tier could not be deleted.
+func (h *Handler) RemoveQuotaTier(guildID uint, roleID string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	if !slices.ContainsFunc(server.QuotaTiers, func(t QuotaTier) bool { return t.RoleID == roleID }) {
+		return fmt.Errorf("<@&%s> has no quota tier", roleID)
+	}
+	if err := h.store.RemoveQuotaTier(guildID, roleID); err != nil {
+		return err
+	}
+	server.QuotaTiers = slices.DeleteFunc(server.QuotaTiers, func(t QuotaTier) bool { return t.RoleID == roleID })
+	return nil
+}
+
+// formatLimits formats quotas on one line.
+func formatLimits(l QuotaLimits) string {
+	return fmt.Sprintf("%d translations a day, %d a month, %s characters a day, %s a month",
+		l.DailyQuota, l.MonthlyQuota, formatCharQuota(l.DailyCharQuota), formatCharQuota(l.MonthlyCharQuota))
+}
+
+// FormatQuotaTiers returns a server's quota tiers, highest first, one per line.
+func (h *Handler) FormatQuotaTiers(guildID uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil || len(server.QuotaTiers) == 0 {
+		return "This server has no quota tiers."
+	}
+	tiers := slices.Clone(server.QuotaTiers)
+	slices.SortStableFunc(tiers, func(a, b QuotaTier) int { return b.QuotaLimits.compare(a.QuotaLimits) })
+	var str string
+	for _, tier := range tiers {
+		str += fmt.Sprintf("<@&%s>: %s\n", tier.RoleID, formatLimits(tier.QuotaLimits))
+	}
+	return str
+}
+
+func (h *Handler) handleQuotaTierCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'quotatier' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "quotatier")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, h.FormatQuotaTiers(uint(guildID)))
+		return
+	}
+	if !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+
+	usage := "Usage: <quotatier>, <quotatier set @role <daily> <monthly> <dailychars> <monthlychars>> or <quotatier remove @role>"
+	if len(args) < 2 || !strings.HasPrefix(args[1], "<@&") {
+		s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+	role := strings.TrimSuffix(strings.TrimPrefix(args[1], "<@&"), ">")
+	var err error
+	switch {
+	case args[0] == "set" && len(args) == 6:
+		var values [4]uint64
+		for i, bits := range []int{16, 16, 64, 64} {
+			if values[i], err = strconv.ParseUint(args[2+i], 10, bits); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = h.SetQuotaTier(uint(guildID), role, QuotaLimits{
+				DailyQuota:       uint16(values[0]),
+				MonthlyQuota:     uint16(values[1]),
+				DailyCharQuota:   values[2],
+				MonthlyCharQuota: values[3],
+			})
+		}
+	case args[0] == "remove" && len(args) == 2:
+		err = h.RemoveQuotaTier(uint(guildID), role)
+	default:
+		s.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to update the quota tier: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatQuotaTiers(uint(guildID)))
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,268 @@
+package botdbStats
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+// Scopes of a translation rate limit
+const (
+	RateScopeUser    = "user"
+	RateScopeChannel = "channel"
+	RateScopeGuild   = "guild"
+)
+
+var rateScopes = []string{RateScopeUser, RateScopeChannel, RateScopeGuild}
+
+var defaultRateLimits = map[string]RateLimit{
+	RateScopeUser:    {Chars: 2000, WindowSeconds: 60},
+	RateScopeChannel: {Chars: 6000, WindowSeconds: 60},
+	RateScopeGuild:   {Chars: 20000, WindowSeconds: 60},
+}
+
+// rateBucketsMax is how many buckets are kept before the full ones are dropped
+const rateBucketsMax = 10000
+
+var ErrRateLimited = errors.New("translation rate limit reached")
+
+// RateLimit is how many characters may be translated in a rolling window.
+type RateLimit struct {
+	Chars         uint32 // Characters per window, 0 uses the default
+	WindowSeconds uint32 // Length of the window in seconds, 0 uses the default
+}
+
+// RateLimitError tells which rate limit stopped a translation and when enough of it is free again.
+type RateLimitError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit reached, retry in %s", e.Scope, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// tokenBucket holds the characters a scope may still translate, refilled evenly over the window.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateKey struct {
+	scope string
+	id    string
+}
+
+// withDefaults fills the unset fields of a limit from the scope's default.
+func (r RateLimit) withDefaults(scope string) RateLimit {
+	def := defaultRateLimits[scope]
+	if r.Chars == 0 {
+		r.Chars = def.Chars
+	}
+	if r.WindowSeconds == 0 {
+		r.WindowSeconds = def.WindowSeconds
+	}
+	return r
+}
+
+// perSecond returns the characters a limit frees each second.
+func (r RateLimit) perSecond() float64 {
+	return float64(r.Chars) / float64(r.WindowSeconds)
+}
+
+// refill adds the characters freed since the bucket was last used, up to the limit, rateLock must be held.
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	b.tokens = min(float64(limit.Chars), b.tokens+now.Sub(b.updated).Seconds()*limit.perSecond())
+	b.updated = now
+}
+
+// rateLimitFields returns the stats fields holding a scope's limit and their names, lock must be held.
+func (h *Handler) rateLimitFields(scope string) (chars, seconds *uint32, names []string) {
+	switch scope {
+	case RateScopeUser:
+		return &h.stats.UserRateChars, &h.stats.UserRateSeconds, []string{"UserRateChars", "UserRateSeconds"}
+	case RateScopeChannel:
+		return &h.stats.ChannelRateChars, &h.stats.ChannelRateSeconds, []string{"ChannelRateChars", "ChannelRateSeconds"}
+	case RateScopeGuild:
+		return &h.stats.GuildRateChars, &h.stats.GuildRateSeconds, []string{"GuildRateChars", "GuildRateSeconds"}
+	}
+	return nil, nil, nil
+}
+
+// RateLimits returns the limits in force for each scope.
+func (h *Handler) RateLimits() map[string]RateLimit {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	limits := make(map[string]RateLimit, len(rateScopes))
+	for _, scope := range rateScopes {
+		chars, seconds, _ := h.rateLimitFields(scope)
+		limits[scope] = RateLimit{Chars: *chars, WindowSeconds: *seconds}.withDefaults(scope)
+	}
+	return limits
+}
+
+// SetRateLimit sets how many characters a scope may translate per rolling window.
+//
+// @param scope: RateScopeUser, RateScopeChannel or RateScopeGuild.
+// @param chars: The characters per window, 0 for the default.
+// @param windowSeconds: The window in seconds, 0 for the default.
+// @return error: An error if the scope is unknown or the setting could not be saved.
+func (h *Handler) SetRateLimit(scope string, chars, windowSeconds uint32) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	charsField, secondsField, names := h.rateLimitFields(scope)
+	if names == nil {
+		return fmt.Errorf("unknown rate limit scope '%s'", scope)
+	}
+	*charsField, *secondsField = chars, windowSeconds
+	return h.updateStats(names...)
+}
+
+// rateKeys returns the buckets a translation in a channel draws from, in the order of rateScopes.
+func rateKeys(guildID uint, channelID string, userID uint) []rateKey {
+	return []rateKey{
+		{RateScopeUser, strconv.FormatUint(uint64(userID), 10)},
+		{RateScopeChannel, channelID},
+		{RateScopeGuild, strconv.FormatUint(uint64(guildID), 10)},
+	}
+}
+
+// TakeRateLimit takes chars characters from the user's, the channel's and the server's rate limits.
+// Nothing is taken unless all three have room. A translation longer than a whole window is let through
+// when the bucket is full and its excess is paid off before the next one.
+//
+// @param guildID: The server's ID
+// @param channelID: The channel's ID
+// @param userID: The user's ID
+// @param chars: The characters to be translated.
+// @return error: A *RateLimitError if a limit has too little room.
+func (h *Handler) TakeRateLimit(guildID uint, channelID string, userID uint, chars int) error {
+	if chars <= 0 {
+		return nil
+	}
+	limits := h.RateLimits()
+	now := time.Now()
+
+	h.rateLock.Lock()
+	defer h.rateLock.Unlock()
+	keys := rateKeys(guildID, channelID, userID)
+	buckets := make([]*tokenBucket, len(keys))
+	var limited *RateLimitError
+	for i, key := range keys {
+		limit := limits[key.scope]
+		bucket, ok := h.rateBuckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(limit.Chars), updated: now}
+		}
+		bucket.refill(limit, now)
+		buckets[i] = bucket
+		need := min(float64(chars), float64(limit.Chars))
+		if bucket.tokens < need {
+			wait := time.Duration((need - bucket.tokens) / limit.perSecond() * float64(time.Second)).Round(time.Second)
+			if limited == nil || wait > limited.RetryAfter {
+				limited = &RateLimitError{Scope: key.scope, RetryAfter: max(wait, time.Second)}
+			}
+		}
+	}
+	if limited != nil {
+		return limited
+	}
+	for i, key := range keys {
+		buckets[i].tokens -= float64(chars)
+		h.rateBuckets[key] = buckets[i]
+	}
+	if len(h.rateBuckets) > rateBucketsMax {
+		h.pruneRateBuckets(limits, now)
+	}
+	return nil
+}
+
+// ReturnRateLimit gives back characters taken for a translation that was not made.
+//
+// @param guildID: The server's ID
+// @param channelID: The channel's ID
+// @param userID: The user's ID
+// @param chars: The characters taken.
+func (h *Handler) ReturnRateLimit(guildID uint, channelID string, userID uint, chars int) {
+	if chars <= 0 {
+		return
+	}
+	limits := h.RateLimits()
+	now := time.Now()
+
+	h.rateLock.Lock()
+	defer h.rateLock.Unlock()
+	for _, key := range rateKeys(guildID, channelID, userID) {
+		if bucket, ok := h.rateBuckets[key]; ok {
+			bucket.refill(limits[key.scope], now)
+			bucket.tokens = min(float64(limits[key.scope].Chars), bucket.tokens+float64(chars))
+		}
+	}
+}
+
+// pruneRateBuckets drops the buckets that have refilled, they behave as new ones, rateLock must be held.
+func (h *Handler) pruneRateBuckets(limits map[string]RateLimit, now time.Time) {
+	for key, bucket := range h.rateBuckets {
+		bucket.refill(limits[key.scope], now)
+		if bucket.tokens >= float64(limits[key.scope].Chars) {
+			delete(h.rateBuckets, key)
+		}
+	}
+}
+
+// FormatRateLimits returns the rate limits and whether request quotas are enforced, one per line.
+func (h *Handler) FormatRateLimits() string {
+	limits := h.RateLimits()
+	var str string
+	for _, scope := range rateScopes {
+		str += fmt.Sprintf("Per %s: %d characters every %d seconds\n", scope, limits[scope].Chars, limits[scope].WindowSeconds)
+	}
+	requests := "off"
+	if h.RequestQuotasEnabled() {
+		requests = "on"
+	}
+	str += fmt.Sprintf("Request quotas: %s\n", requests)
+	return str
+}
+
+func (h *Handler) handleRateLimitCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'ratelimit' Cmd")
+	if !botUtils.IsBotOwner(s, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+
+	args := botUtils.GetCmdArgs(m.Content, "ratelimit")
+	var err error
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "requests" && (args[1] == "on" || args[1] == "off"):
+		err = h.SetRequestQuotas(args[1] == "on")
+	case len(args) == 3:
+		var chars, seconds uint64
+		if chars, err = strconv.ParseUint(args[1], 10, 32); err == nil {
+			if seconds, err = strconv.ParseUint(args[2], 10, 32); err == nil {
+				err = h.SetRateLimit(args[0], uint32(chars), uint32(seconds))
+			}
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Usage: <ratelimit>, <ratelimit user 2000 60>, <ratelimit channel 6000 60>, "+
+			"<ratelimit guild 20000 60> or <ratelimit requests on|off>")
+		return
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to update rate limits: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatRateLimits())
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,54 @@
+package botdbStats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	limit := RateLimit{Chars: 60, WindowSeconds: 60}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 20, 0, 20},
+		{"empty bucket refills evenly", 0, 10 * time.Second, 10},
+		{"partly used bucket", 30, 15 * time.Second, 45},
+		{"full bucket stays full", 60, time.Minute, 60},
+		{"refill stops at the limit", 0, 2 * time.Minute, 60},
+		{"excess of a long translation is paid off first", -30, 20 * time.Second, -10},
+		{"excess paid off and refilled", -30, time.Minute, 30},
+	}
+	for _, tt := range tests {
+		bucket := tokenBucket{tokens: tt.tokens, updated: start}
+		now := start.Add(tt.elapsed)
+		bucket.refill(limit, now)
+		if bucket.tokens != tt.want {
+			t.Errorf("%s: %v tokens, want %v", tt.name, bucket.tokens, tt.want)
+		}
+		if !bucket.updated.Equal(now) {
+			t.Errorf("%s: updated at %v, want %v", tt.name, bucket.updated, now)
+		}
+	}
+}
+
+func TestRateLimitWithDefaults(t *testing.T) {
+	def := defaultRateLimits[RateScopeUser]
+	tests := []struct {
+		limit RateLimit
+		want  RateLimit
+	}{
+		{RateLimit{}, def},
+		{RateLimit{Chars: 100}, RateLimit{Chars: 100, WindowSeconds: def.WindowSeconds}},
+		{RateLimit{WindowSeconds: 10}, RateLimit{Chars: def.Chars, WindowSeconds: 10}},
+		{RateLimit{Chars: 100, WindowSeconds: 10}, RateLimit{Chars: 100, WindowSeconds: 10}},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.withDefaults(RateScopeUser); got != tt.want {
+			t.Errorf("%+v.withDefaults() = %+v, want %+v", tt.limit, got, tt.want)
+		}
+	}
+}
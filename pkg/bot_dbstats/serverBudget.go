@@ -0,0 +1,249 @@
+package botdbStats
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+// Rules for what happens to the unused part of a server budget when the month rolls over
+const (
+	UnusedShareRelease  = "release"  // unused symbols return to the global pool
+	UnusedShareRollover = "rollover" // unused symbols carry over to the next month, up to one month's budget
+)
+
+var ErrServerBudgetExceeded = errors.New("server symbol budget exceeded")
+
+// findServer returns the server with the given ID, lock must be held.
+func (h *Handler) findServer(guildID uint) *DiscordServer {
+	n, found := slices.BinarySearchFunc(h.stats.Servers, guildID, func(a DiscordServer, b uint) int {
+		return cmp.Compare(a.ID, b)
+	})
+	if !found {
+		return nil
+	}
+	return &h.stats.Servers[n]
+}
+
+func (ds *DiscordServer) unusedShareRule() string {
+	if ds.UnusedShare == "" {
+		return UnusedShareRelease
+	}
+	return ds.UnusedShare
+}
+
+// budgetRemaining returns the symbols left in the server's own budget and whether it has one.
+func (h *Handler) budgetRemaining(ds *DiscordServer) (uint64, bool) {
+	if ds.SymbolBudget == 0 {
+		return 0, false
+	}
+	total := ds.SymbolBudget + ds.SymbolCarryOver
+	used := ds.SymbolsUsed + h.serverReserved[ds.ID]
+	if used >= total {
+		return 0, true
+	}
+	return total - used, true
+}
+
+// fairShareRemaining returns the symbols left in the server's fair share while the global pool is low.
+func (h *Handler) fairShareRemaining(ds *DiscordServer) (uint64, bool) {
+	if h.stats.FairShareSymbols == 0 {
+		return 0, false
+	}
+	if ds.SymbolsUsed < ds.FairShareBaseline {
+		return 0, true
+	}
+	used := ds.SymbolsUsed + h.serverReserved[ds.ID] - ds.FairShareBaseline
+	if used >= h.stats.FairShareSymbols {
+		return 0, true
+	}
+	return min(h.stats.FairShareSymbols-used, h.poolRemaining()), true
+}
+
+// poolRemaining returns the symbols left in the global pool before the hard stop, lock must be held.
+func (h *Handler) poolRemaining() uint64 {
+	used := h.stats.SymbolsTranslated + h.reservedSymbols
+	if used >= h.hardStopSymbols() {
+		return 0
+	}
+	return h.hardStopSymbols() - used
+}
+
+// updateFairShare starts splitting the remaining pool evenly across all servers once usage
+// passes the soft-warning threshold, lock must be held. Every server gets a share, whether or not it
+// translated before the pool went low, so the shares add up to no more than what is left.
+func (h *Handler) updateFairShare() {
+	if h.stats.FairShareSymbols != 0 {
+		return
+	}
+	used := h.stats.SymbolsTranslated + h.reservedSymbols
+	if used < h.warnSymbols() || used >= h.hardStopSymbols() {
+		return
+	}
+
+	for i := range h.stats.Servers {
+		h.stats.Servers[i].FairShareBaseline = h.stats.Servers[i].SymbolsUsed
+		h.markServerDirty(h.stats.Servers[i].ID)
+	}
+	servers := max(len(h.stats.Servers), 1)
+	h.stats.FairShareSymbols = max(h.poolRemaining()/uint64(servers), 1)
+	h.markStatsDirty()
+	fmt.Printf("updateFairShare: pool low, %d servers get %d symbols each\n", servers, h.stats.FairShareSymbols)
+}
+
+// checkServerBudget returns an error if the server cannot cover the estimate, lock must be held.
+func (h *Handler) checkServerBudget(guildID uint, estimate uint64) error {
+	server := h.findServer(guildID)
+	if server == nil {
+		return nil
+	}
+	if remaining, ok := h.budgetRemaining(server); ok && estimate > remaining {
+		return ErrServerBudgetExceeded
+	}
+	h.updateFairShare()
+	if remaining, ok := h.fairShareRemaining(server); ok && estimate > remaining {
+		return ErrServerBudgetExceeded
+	}
+	return nil
+}
+
+// releaseServerSymbols drops a server's reservation, lock must be held.
+func (h *Handler) releaseServerSymbols(guildID uint, estimate uint64) {
+	if h.serverReserved[guildID] >= estimate {
+		h.serverReserved[guildID] -= estimate
+	} else {
+		h.serverReserved[guildID] = 0
+	}
+}
+
+// rolloverServerBudgets resets the monthly usage of every server, applying its unused-share rule.
+// lock must be held.
+func (h *Handler) rolloverServerBudgets() {
+	h.stats.FairShareSymbols = 0
+	for i := range h.stats.Servers {
+		server := &h.stats.Servers[i]
+		carry := uint64(0)
+		if server.unusedShareRule() == UnusedShareRollover && server.SymbolBudget > 0 {
+			if total := server.SymbolBudget + server.SymbolCarryOver; total > server.SymbolsUsed {
+				carry = min(total-server.SymbolsUsed, server.SymbolBudget)
+			}
+		}
+		server.SymbolCarryOver = carry
+		server.SymbolsUsed = 0
+		server.FairShareBaseline = 0
+		if err := h.updateServer(server, "SymbolCarryOver", "SymbolsUsed", "FairShareBaseline"); err != nil {
+			fmt.Printf("dbStats::rolloverServerBudgets::%s\n", err.Error())
+		}
+	}
+}
+
+// SetServerBudget sets the monthly symbol budget of a server, 0 removes the budget.
+//
+// @param guildID: The server's ID
+// @param budget: The monthly symbol budget.
+// @return error: An error if the server is unknown or could not be saved.
+func (h *Handler) SetServerBudget(guildID uint, budget uint64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.SymbolBudget = budget
+	return h.updateServer(server, "SymbolBudget")
+}
+
+// SetServerUnusedShare sets what happens to a server's unused budget at the end of the month.
+//
+// @param guildID: The server's ID
+// @param rule: UnusedShareRelease or UnusedShareRollover.
+// @return error: An error if the rule or server is unknown or could not be saved.
+func (h *Handler) SetServerUnusedShare(guildID uint, rule string) error {
+	if rule != UnusedShareRelease && rule != UnusedShareRollover {
+		return fmt.Errorf("unknown rule '%s', use %s or %s", rule, UnusedShareRelease, UnusedShareRollover)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.UnusedShare = rule
+	return h.updateServer(server, "UnusedShare")
+}
+
+// FormatServerBudget returns a server's symbol budget as a string with each value on a new line.
+func (h *Handler) FormatServerBudget(guildID uint) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return "No translations recorded for this server yet."
+	}
+	var str string
+	str += fmt.Sprintf("Server: %s\n", server.ServerName)
+	if server.SymbolBudget == 0 {
+		str += "Monthly Budget: none (shares the global pool)\n"
+	} else {
+		str += fmt.Sprintf("Monthly Budget: %d\n", server.SymbolBudget)
+		str += fmt.Sprintf("Carried Over: %d\n", server.SymbolCarryOver)
+	}
+	str += fmt.Sprintf("Symbols Used: %d\n", server.SymbolsUsed)
+	str += fmt.Sprintf("Symbols Reserved: %d\n", h.serverReserved[server.ID])
+	if remaining, ok := h.budgetRemaining(server); ok {
+		str += fmt.Sprintf("Budget Remaining: %d\n", remaining)
+	}
+	str += fmt.Sprintf("Unused Share: %s\n", server.unusedShareRule())
+	if remaining, ok := h.fairShareRemaining(server); ok {
+		str += fmt.Sprintf("Fair Share (global pool low): %d per server, %d remaining\n",
+			h.stats.FairShareSymbols, remaining)
+	}
+	return str
+}
+
+func (h *Handler) handleServerBudgetCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'serverbudget' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+
+	args := botUtils.GetCmdArgs(m.Content, "serverbudget")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, h.FormatServerBudget(uint(guildID)))
+		return
+	}
+	if !botUtils.IsBotOwner(s, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	if len(args) != 2 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <serverbudget>, <serverbudget set <symbols>> or <serverbudget rule release|rollover>")
+		return
+	}
+
+	var err error
+	switch args[0] {
+	case "set":
+		var budget uint64
+		if budget, err = strconv.ParseUint(args[1], 10, 64); err == nil {
+			err = h.SetServerBudget(uint(guildID), budget)
+		}
+	case "rule":
+		err = h.SetServerUnusedShare(uint(guildID), args[1])
+	default:
+		err = fmt.Errorf("unknown server budget setting '%s'", args[0])
+	}
+
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to update server budget: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatServerBudget(uint(guildID)))
+	fmt.Println("End Cmd")
+}
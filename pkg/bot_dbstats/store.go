@@ -0,0 +1,325 @@
+package botdbStats
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StatsStore persists the bot's counters, servers, users, quotas and blacklist.
+// A Handler keeps a working copy loaded from its store and writes changes back through it.
+// Fields are named by their Go field names, as with gorm's Select.
+type StatsStore interface {
+	// LoadStats returns the bot's stats with their servers, members and blacklist, creating them on first use.
+	LoadStats() (*GoogleTranslateStats, error)
+	// SaveChanges saves the stats, unless nil, and the given servers and users without their associations,
+	// in one transaction. Usage counters are left as stored, they only change through AddSymbols, ChargeUser
+	// and AddTranslates or when named in an update.
+	SaveChanges(stats *GoogleTranslateStats, servers []DiscordServer, users []DiscordUser) error
+	// AddSymbols adds billed symbols to the stats and a server in one transaction and returns the new totals.
+	AddSymbols(statsID, guildID uint, n uint64) (total, serverUsed uint64, err error)
+	// ChargeUser adds a charge to a user's daily and monthly use in one transaction and returns the new use.
+	// It fails with ErrQuotaExceeded if that would pass a character limit of the charge, or a request limit when
+	// the charge checks them. Negative amounts give use back.
+	ChargeUser(userID uint, charge UserCharge) (UserUsage, error)
+	// AddTranslates adds n to a user's translation count and returns the new count.
+	AddTranslates(userID uint, n uint64) (uint64, error)
+	// ResetUserUsage zeroes the named usage fields of a server's users and records the reset in one transaction.
+	// It returns false without changing anything if the reset of that kind and period is already recorded.
+	ResetUserUsage(kind string, guildID uint, periodStart time.Time, fields ...string) (bool, error)
+	// LastQuotaReset returns the latest period start recorded for a kind of reset in a server, zero if there is none.
+	LastQuotaReset(kind string, guildID uint) (time.Time, error)
+	// UpdateUserQuotas saves the named fields of a user and adds the audit entries of the change in one transaction.
+	UpdateUserQuotas(user *DiscordUser, fields []string, audits []QuotaAudit) error
+	// UpdateServerQuotas saves the named fields of a server and adds the audit entries of the change in one transaction.
+	UpdateServerQuotas(server *DiscordServer, fields []string, audits []QuotaAudit) error
+	// QuotaAudits returns the latest n quota changes of a user in a server, newest first. A user ID of 0 returns
+	// the changes of the server's defaults.
+	QuotaAudits(guildID, userID uint, n int) ([]QuotaAudit, error)
+	// SaveQuotaTier adds a role's quota tier to a server or replaces the role's tier, setting the entry's ID.
+	SaveQuotaTier(tier *QuotaTier) error
+	// RemoveQuotaTier deletes a role's quota tier from a server.
+	RemoveQuotaTier(guildID uint, roleID string) error
+	// UpdateStats saves the named fields of the stats.
+	UpdateStats(stats *GoogleTranslateStats, fields ...string) error
+	// UpdateServer saves the named fields of a server.
+	UpdateServer(server *DiscordServer, fields ...string) error
+	// UpdateUser saves the named fields of a user.
+	UpdateUser(user *DiscordUser, fields ...string) error
+	// AddBlacklisted bans a user, setting the entry's ID.
+	AddBlacklisted(entry *BlacklistedUser) error
+	// RemoveBlacklisted lifts a user's ban.
+	RemoveBlacklisted(userID uint) error
+	// BlacklistedSince returns the users banned at or after t.
+	BlacklistedSince(t time.Time) ([]BlacklistedUser, error)
+}
+
+var ErrQuotaExceeded = errors.New("translation quota exceeded")
+
+// UserCharge is what a translation adds to a user's use of their quotas.
+type UserCharge struct {
+	Chars         int         // Billed characters, negative to give them back
+	Requests      int         // Translation requests, negative to give them back
+	CheckRequests bool        // Whether the request-count quotas are enforced as well as the character quotas
+	Limits        QuotaLimits // The user's effective quotas, from their own quotas or their roles' tier
+}
+
+// UserUsage is a user's use of their daily and monthly quotas.
+type UserUsage struct {
+	DailyAccrued        uint16
+	MonthlyAccrued      uint16
+	DailyCharsAccrued   uint64
+	MonthlyCharsAccrued uint64
+}
+
+// Usage counters written only as increments, never by saving a whole row
+var statsCounters = []string{"SymbolsTranslated"}
+var serverCounters = []string{"SymbolsUsed"}
+var userCounters = []string{"DailyAccrued", "MonthlyAccrued", "DailyCharsAccrued", "MonthlyCharsAccrued", "NumOfTranslates"}
+
+// newStats returns the stats of a bot that has not translated anything yet.
+func newStats() *GoogleTranslateStats {
+	now := time.Now().UTC()
+	return &GoogleTranslateStats{
+		ResetDateTime:          nextBillingReset(now, 1, time.UTC),
+		LastUserSuccess:        now,
+		LastUserFailure:        now,
+		SymbolsMonthlyCap:      500000,
+		SymbolsWarnPercent:     defaultWarnPercent,
+		SymbolsHardStopPercent: defaultHardStopPercent,
+	}
+}
+
+// gormStore keeps the stats in the database.
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a StatsStore backed by a gorm database.
+//
+// @param db: The database, already migrated.
+// @return StatsStore: The store.
+func NewGormStore(db *gorm.DB) StatsStore {
+	return &gormStore{db: db}
+}
+
+func (g *gormStore) LoadStats() (*GoogleTranslateStats, error) {
+	var stats []GoogleTranslateStats
+	res := g.db.Preload("BlacklistedUsers").
+		Preload("Servers").
+		Preload("Servers.Members").
+		Preload("Servers.QuotaTiers").
+		Order("id").Limit(1).Find(&stats)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(stats) > 0 {
+		return &stats[0], nil
+	}
+	created := newStats()
+	if res := g.db.Create(created); res.Error != nil {
+		return nil, res.Error
+	}
+	return created, nil
+}
+
+func (g *gormStore) SaveChanges(stats *GoogleTranslateStats, servers []DiscordServer, users []DiscordUser) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if stats != nil {
+			if err := tx.Omit(append(statsCounters, clause.Associations)...).Save(stats).Error; err != nil {
+				return err
+			}
+		}
+		for i := range servers {
+			if err := tx.Omit(append(serverCounters, clause.Associations)...).Save(&servers[i]).Error; err != nil {
+				return err
+			}
+		}
+		for i := range users {
+			if err := tx.Omit(append(userCounters, clause.Associations)...).Save(&users[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (g *gormStore) AddSymbols(statsID, guildID uint, n uint64) (total, serverUsed uint64, err error) {
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&GoogleTranslateStats{}).Where("id = ?", statsID).
+			Update("symbols_translated", gorm.Expr("symbols_translated + ?", n)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&DiscordServer{}).Where("id = ?", guildID).
+			Update("symbols_used", gorm.Expr("symbols_used + ?", n)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&GoogleTranslateStats{}).Where("id = ?", statsID).
+			Select("symbols_translated").Scan(&total).Error; err != nil {
+			return err
+		}
+		return tx.Model(&DiscordServer{}).Where("id = ?", guildID).Select("symbols_used").Scan(&serverUsed).Error
+	})
+	return total, serverUsed, err
+}
+
+func (g *gormStore) ChargeUser(userID uint, charge UserCharge) (UserUsage, error) {
+	var usage UserUsage
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&DiscordUser{}).Where("id = ?", userID)
+		limits := charge.Limits
+		if charge.Chars > 0 && limits.DailyCharQuota > 0 {
+			query = query.Where("daily_chars_accrued + ? <= ?", charge.Chars, limits.DailyCharQuota)
+		}
+		if charge.Chars > 0 && limits.MonthlyCharQuota > 0 {
+			query = query.Where("monthly_chars_accrued + ? <= ?", charge.Chars, limits.MonthlyCharQuota)
+		}
+		if charge.Requests > 0 && charge.CheckRequests {
+			query = query.Where("daily_accrued + ? <= ? AND monthly_accrued + ? <= ?",
+				charge.Requests, limits.DailyQuota, charge.Requests, limits.MonthlyQuota)
+		}
+		res := query.Updates(map[string]interface{}{
+			"daily_chars_accrued":   counterExpr("daily_chars_accrued", charge.Chars),
+			"monthly_chars_accrued": counterExpr("monthly_chars_accrued", charge.Chars),
+			"daily_accrued":         counterExpr("daily_accrued", charge.Requests),
+			"monthly_accrued":       counterExpr("monthly_accrued", charge.Requests),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 && (charge.Chars > 0 || charge.Requests > 0) {
+			return ErrQuotaExceeded
+		}
+		var user DiscordUser
+		err := tx.Select("daily_accrued", "monthly_accrued", "daily_chars_accrued", "monthly_chars_accrued").
+			Where("id = ?", userID).Take(&user).Error
+		if err != nil {
+			return err
+		}
+		usage = UserUsage{user.DailyAccrued, user.MonthlyAccrued, user.DailyCharsAccrued, user.MonthlyCharsAccrued}
+		return nil
+	})
+	return usage, err
+}
+
+// counterExpr returns the expression adding n to a counter column, a negative n takes away no more than it holds.
+func counterExpr(column string, n int) clause.Expr {
+	if n >= 0 {
+		return gorm.Expr(column+" + ?", n)
+	}
+	return gorm.Expr("CASE WHEN "+column+" > ? THEN "+column+" - ? ELSE 0 END", -n, -n)
+}
+
+func (g *gormStore) AddTranslates(userID uint, n uint64) (uint64, error) {
+	var count uint64
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&DiscordUser{}).Where("id = ?", userID).
+			Update("num_of_translates", gorm.Expr("num_of_translates + ?", n)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&DiscordUser{}).Where("id = ?", userID).Select("num_of_translates").Scan(&count).Error
+	})
+	return count, err
+}
+
+func (g *gormStore) UpdateUserQuotas(user *DiscordUser, fields []string, audits []QuotaAudit) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Select(fields).Updates(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&audits).Error
+	})
+}
+
+func (g *gormStore) UpdateServerQuotas(server *DiscordServer, fields []string, audits []QuotaAudit) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(server).Select(fields).Updates(server).Error; err != nil {
+			return err
+		}
+		return tx.Create(&audits).Error
+	})
+}
+
+func (g *gormStore) QuotaAudits(guildID, userID uint, n int) ([]QuotaAudit, error) {
+	var audits []QuotaAudit
+	res := g.db.Where("discord_server_id = ? AND discord_user_id = ?", guildID, userID).Order("id desc").Limit(n).Find(&audits)
+	return audits, res.Error
+}
+
+func (g *gormStore) SaveQuotaTier(tier *QuotaTier) error {
+	return g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "discord_server_id"}, {Name: "role_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "daily_quota", "monthly_quota", "daily_char_quota", "monthly_char_quota"}),
+	}).Create(tier).Error
+}
+
+func (g *gormStore) RemoveQuotaTier(guildID uint, roleID string) error {
+	return g.db.Unscoped().Where("discord_server_id = ? AND role_id = ?", guildID, roleID).Delete(&QuotaTier{}).Error
+}
+
+func (g *gormStore) UpdateStats(stats *GoogleTranslateStats, fields ...string) error {
+	return g.db.Model(stats).Select(fields).Updates(stats).Error
+}
+
+func (g *gormStore) UpdateServer(server *DiscordServer, fields ...string) error {
+	return g.db.Model(server).Select(fields).Updates(server).Error
+}
+
+func (g *gormStore) UpdateUser(user *DiscordUser, fields ...string) error {
+	return g.db.Model(user).Select(fields).Updates(user).Error
+}
+
+func (g *gormStore) ResetUserUsage(kind string, guildID uint, periodStart time.Time, fields ...string) (bool, error) {
+	reset := QuotaReset{DiscordServerID: guildID, Kind: kind, PeriodStart: periodStart}
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reset)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reset.ID = 0
+			return nil
+		}
+		zero := map[string]interface{}{}
+		var used []string
+		for _, field := range fields {
+			column := tx.NamingStrategy.ColumnName("", field)
+			zero[column] = 0
+			used = append(used, column+" > 0")
+		}
+		res = tx.Model(&DiscordUser{}).Where("discord_server_id = ?", guildID).
+			Where(strings.Join(used, " OR ")).Updates(zero)
+		if res.Error != nil {
+			return res.Error
+		}
+		reset.UsersReset = res.RowsAffected
+		return tx.Model(&reset).Update("users_reset", reset.UsersReset).Error
+	})
+	return err == nil && reset.ID != 0, err
+}
+
+func (g *gormStore) LastQuotaReset(kind string, guildID uint) (time.Time, error) {
+	var resets []QuotaReset
+	res := g.db.Where("kind = ? AND discord_server_id = ?", kind, guildID).Order("period_start desc").Limit(1).Find(&resets)
+	if res.Error != nil || len(resets) == 0 {
+		return time.Time{}, res.Error
+	}
+	return resets[0].PeriodStart, nil
+}
+
+func (g *gormStore) AddBlacklisted(entry *BlacklistedUser) error {
+	return g.db.Omit("User").Create(entry).Error
+}
+
+func (g *gormStore) RemoveBlacklisted(userID uint) error {
+	return g.db.Unscoped().Where("user_id = ?", userID).Delete(&BlacklistedUser{}).Error
+}
+
+func (g *gormStore) BlacklistedSince(t time.Time) ([]BlacklistedUser, error) {
+	var banned []BlacklistedUser
+	res := g.db.Where("start_ban_date_time >= ?", t).Find(&banned)
+	return banned, res.Error
+}
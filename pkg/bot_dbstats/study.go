@@ -0,0 +1,187 @@
+package botdbStats
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Where a study card was built from
+const (
+	CardOriginHistory    = "history"
+	CardOriginPhrasebook = "phrasebook"
+)
+
+const defaultEaseFactor = 2.5
+const minEaseFactor = 1.3
+
+// relearnDelay is how soon a forgotten card comes back in the same study session
+const relearnDelay = 10 * time.Minute
+
+// StudyCard is a flashcard of a user with its SM-2 review schedule.
+type StudyCard struct {
+	gorm.Model
+	DiscordUserID  uint   `gorm:"index"` // The DiscordUser studying the card
+	Origin         string `gorm:"size:16"`
+	OriginID       uint
+	SourceLanguage string `gorm:"size:16"`
+	TargetLanguage string `gorm:"size:16"`
+	Front          string `gorm:"type:text"`
+	Back           string `gorm:"type:text"`
+	EaseFactor     float64
+	IntervalDays   int
+	Repetitions    int
+	DueAt          time.Time `gorm:"index"`
+	LastReviewedAt time.Time
+	Reviews        uint
+	Lapses         uint
+}
+
+// UserServerID returns the ID of the server a user is a member of.
+func (h *Handler) UserServerID(uid uint) (uint, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	has, _, server := h.stats.containsUser(uid)
+	if !has {
+		return 0, false
+	}
+	return server.ID, true
+}
+
+// SyncStudyCards adds a card for each translation in the user's history and each phrase of the user's
+// server phrasebook that the user has no card for yet.
+//
+// @param userID: The user's ID
+// @return int: The number of cards added.
+// @return error: An error if the cards could not be read or saved.
+func (h *Handler) SyncStudyCards(userID uint) (int, error) {
+	var existing []StudyCard
+	if res := h.db.Select("origin", "origin_id").Where("discord_user_id = ?", userID).Find(&existing); res.Error != nil {
+		return 0, res.Error
+	}
+	has := map[string]map[uint]bool{CardOriginHistory: {}, CardOriginPhrasebook: {}}
+	for _, c := range existing {
+		if has[c.Origin] != nil {
+			has[c.Origin][c.OriginID] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	var cards []StudyCard
+	newCard := func(origin string, id uint, src, tgt, front, back string) {
+		if has[origin][id] || front == "" || back == "" {
+			return
+		}
+		has[origin][id] = true
+		cards = append(cards, StudyCard{
+			DiscordUserID: userID, Origin: origin, OriginID: id,
+			SourceLanguage: src, TargetLanguage: tgt, Front: front, Back: back,
+			EaseFactor: defaultEaseFactor, DueAt: now,
+		})
+	}
+
+	var records []TranslationRecord
+	if res := h.db.Where("discord_user_id = ?", userID).Find(&records); res.Error != nil {
+		return 0, res.Error
+	}
+	for _, r := range records {
+		newCard(CardOriginHistory, r.ID, r.SourceLanguage, r.TargetLanguage, r.SourceText, r.OutputText)
+	}
+	if guildID, ok := h.UserServerID(userID); ok {
+		phrases, err := h.GetPhrasebook(guildID, "")
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range phrases {
+			newCard(CardOriginPhrasebook, p.ID, p.SourceLanguage, p.TargetLanguage, p.SourceText, p.TranslatedText)
+		}
+	}
+
+	if len(cards) == 0 {
+		return 0, nil
+	}
+	return len(cards), h.db.CreateInBatches(cards, 100).Error
+}
+
+// NextStudyCard returns the user's most overdue card and how many cards are due, nil if none is due.
+//
+// @param userID: The user's ID
+// @return *StudyCard: The next card to review.
+// @return int64: The number of cards due now.
+func (h *Handler) NextStudyCard(userID uint) (*StudyCard, int64) {
+	now := time.Now().UTC()
+	var due int64
+	h.db.Model(&StudyCard{}).Where("discord_user_id = ? AND due_at <= ?", userID, now).Count(&due)
+	var cards []StudyCard
+	h.db.Where("discord_user_id = ? AND due_at <= ?", userID, now).Order("due_at").Limit(1).Find(&cards)
+	if len(cards) == 0 {
+		return nil, 0
+	}
+	return &cards[0], due
+}
+
+// NextStudyDue returns when the user's next card becomes due, zero if the user has no cards.
+func (h *Handler) NextStudyDue(userID uint) time.Time {
+	var cards []StudyCard
+	h.db.Where("discord_user_id = ?", userID).Order("due_at").Limit(1).Find(&cards)
+	if len(cards) == 0 {
+		return time.Time{}
+	}
+	return cards[0].DueAt
+}
+
+// GetStudyCard returns one of the user's cards, nil if the user has no such card.
+func (h *Handler) GetStudyCard(userID, id uint) *StudyCard {
+	var cards []StudyCard
+	if res := h.db.Where("discord_user_id = ? AND id = ?", userID, id).Limit(1).Find(&cards); res.Error != nil || len(cards) == 0 {
+		return nil
+	}
+	return &cards[0]
+}
+
+// ReviewStudyCard schedules a card's next review with the SM-2 algorithm and saves it.
+// Quality is 0 (forgot) to 5 (perfect recall), below 3 the card starts over.
+//
+// @param card: The reviewed card.
+// @param quality: The user's answer quality from 0 to 5.
+// @return error: An error if the card could not be saved.
+func (h *Handler) ReviewStudyCard(card *StudyCard, quality int) error {
+	quality = min(max(quality, 0), 5)
+	now := time.Now().UTC()
+	if card.EaseFactor == 0 {
+		card.EaseFactor = defaultEaseFactor
+	}
+
+	if quality < 3 {
+		card.Repetitions = 0
+		card.IntervalDays = 1
+		card.Lapses++
+		card.DueAt = now.Add(relearnDelay)
+	} else {
+		switch card.Repetitions {
+		case 0:
+			card.IntervalDays = 1
+		case 1:
+			card.IntervalDays = 6
+		default:
+			card.IntervalDays = int(math.Round(float64(card.IntervalDays) * card.EaseFactor))
+		}
+		card.Repetitions++
+		card.DueAt = now.AddDate(0, 0, card.IntervalDays)
+	}
+	q := float64(5 - quality)
+	card.EaseFactor = max(card.EaseFactor+0.1-q*(0.08+q*0.02), minEaseFactor)
+	card.Reviews++
+	card.LastReviewedAt = now
+	return h.db.Save(card).Error
+}
+
+// StudyStats returns how many cards a user has, how many are due and how many are learned.
+// A card counts as learned once its interval reaches three weeks.
+func (h *Handler) StudyStats(userID uint) (total, due, learned int64) {
+	h.db.Model(&StudyCard{}).Where("discord_user_id = ?", userID).Count(&total)
+	h.db.Model(&StudyCard{}).Where("discord_user_id = ? AND due_at <= ?", userID, time.Now().UTC()).Count(&due)
+	h.db.Model(&StudyCard{}).Where("discord_user_id = ? AND interval_days >= ?", userID, 21).Count(&learned)
+	return total, due, learned
+}
@@ -0,0 +1,83 @@
+package botdbStats
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultStickyTimeout = 30 * time.Minute
+
+// OpenStickySession records the start of a user's sticky translation mode in a channel.
+//
+// @param guildID: The server's ID
+// @param userID: The user's ID
+// @param channelID: The channel the mode applies to.
+// @param langFrom: The source language.
+// @param langTo: The target language.
+// @return uint: The ID of the session row.
+// @return error: An error if the session could not be saved.
+func (h *Handler) OpenStickySession(guildID, userID uint, channelID, langFrom, langTo string) (uint, error) {
+	session := BotTranslateSession{
+		GoogleTranslateStatsID: h.stats.ID,
+		Kind:                   SessionKindSticky,
+		StartDateTime:          time.Now().UTC(),
+		DiscordServerID:        guildID,
+		DiscordUserID:          userID,
+		ChannelID:              channelID,
+		SourceLanguage:         langFrom,
+		TargetLanguage:         langTo,
+	}
+	if res := h.db.Create(&session); res.Error != nil {
+		return 0, res.Error
+	}
+	return session.ID, nil
+}
+
+// CloseTranslateSession records the end of a session and the number of translations made in it.
+//
+// @param id: The ID of the session row.
+// @param translateCount: The number of translations made during the session.
+// @return error: An error if the session could not be saved.
+func (h *Handler) CloseTranslateSession(id uint, translateCount uint64) error {
+	return h.db.Model(&BotTranslateSession{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"end_date_time": time.Now().UTC(), "translate_count": translateCount}).Error
+}
+
+// CloseStaleStickySessions ends the sticky sessions left open when the bot last stopped.
+// Their end time is the last time the row was updated.
+func (h *Handler) CloseStaleStickySessions() {
+	res := h.db.Model(&BotTranslateSession{}).
+		Where("kind = ? AND end_date_time < ?", SessionKindSticky, time.Unix(0, 0)).
+		Update("end_date_time", gorm.Expr("updated_at"))
+	if res.Error != nil {
+		fmt.Printf("dbStats::CloseStaleStickySessions::%s\n", res.Error.Error())
+	}
+}
+
+// StickyTimeout returns how long a server's sticky translation may stay idle.
+func (h *Handler) StickyTimeout(guildID uint) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if server := h.findServer(guildID); server != nil && server.StickyTimeoutMinutes > 0 {
+		return time.Duration(server.StickyTimeoutMinutes) * time.Minute
+	}
+	return defaultStickyTimeout
+}
+
+// SetStickyTimeout sets how many idle minutes end sticky translation in a server.
+//
+// @param guildID: The server's ID
+// @param minutes: The idle timeout in minutes.
+// @return error: An error if the server is unknown or could not be saved.
+func (h *Handler) SetStickyTimeout(guildID uint, minutes uint) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	server := h.findServer(guildID)
+	if server == nil {
+		return fmt.Errorf("server %d not found", guildID)
+	}
+	server.StickyTimeoutMinutes = minutes
+	return h.updateServer(server, "StickyTimeoutMinutes")
+}
@@ -0,0 +1,70 @@
+package botdbStats
+
+import (
+	"strings"
+	"time"
+)
+
+// TMFilter selects the translations exported as translation memory.
+type TMFilter struct {
+	GuildID        uint
+	SourceLanguage string    // Empty for every source language
+	TargetLanguage string    // Empty for every target language
+	Since          time.Time // Zero for no lower bound
+	Until          time.Time // Zero for no upper bound, exclusive
+}
+
+// TMSegment is one source and target pair of translation memory.
+type TMSegment struct {
+	SourceLanguage string
+	TargetLanguage string
+	Source         string
+	Target         string
+	CreatedAt      time.Time
+	CreatedBy      uint
+	Corrected      bool // Target is an approved community correction
+}
+
+// GetTranslationMemory returns the kept translations of a server matching filter, oldest first.
+// Repeated translations of the same text appear once, and approved corrections replace the bot's output.
+//
+// @param filter: The server, language pair and date range to export.
+// @return []TMSegment: The segments.
+// @return error: An error if the translations could not be read.
+func (h *Handler) GetTranslationMemory(filter TMFilter) ([]TMSegment, error) {
+	query := h.db.Where("discord_server_id = ?", filter.GuildID)
+	if filter.SourceLanguage != "" {
+		query = query.Where("source_language = ?", filter.SourceLanguage)
+	}
+	if filter.TargetLanguage != "" {
+		query = query.Where("target_language = ?", filter.TargetLanguage)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until.UTC())
+	}
+	var records []TranslationRecord
+	if res := query.Order("created_at").Find(&records); res.Error != nil {
+		return nil, res.Error
+	}
+
+	seen := map[[3]string]bool{}
+	var segments []TMSegment
+	for _, r := range records {
+		source := strings.TrimSpace(r.SourceText)
+		key := [3]string{r.SourceLanguage, r.TargetLanguage, source}
+		if source == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		segment := TMSegment{SourceLanguage: r.SourceLanguage, TargetLanguage: r.TargetLanguage, Source: source,
+			Target: strings.TrimSpace(r.OutputText), CreatedAt: r.CreatedAt, CreatedBy: r.DiscordUserID}
+		if corrected, ok := h.GetCorrection(filter.GuildID, r.SourceLanguage, r.TargetLanguage, source); ok {
+			segment.Target, segment.Corrected = corrected, true
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
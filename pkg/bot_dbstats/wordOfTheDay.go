@@ -0,0 +1,190 @@
+package botdbStats
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Where a word of the day was picked from
+const (
+	WordOriginPhrasebook = "phrasebook"
+	WordOriginWordList   = "wordlist"
+)
+
+// WordOfTheDayConfig is a server's word of the day post settings.
+type WordOfTheDayConfig struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"uniqueIndex"` // Foreign key referencing the ID field from DiscordServer
+	ChannelID       string `gorm:"size:32"`
+	Language        string `gorm:"size:16"` // The language the words are taught in
+	PostTime        string `gorm:"size:5"`  // Local time of day to post, HH:MM
+	Timezone        string `gorm:"size:64"` // IANA time zone of PostTime
+	Enabled         bool
+	LastPostedDate  string `gorm:"size:10"` // Local date of the last post, YYYY-MM-DD
+}
+
+// WordListEntry is a word imported into a server's word list.
+type WordListEntry struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"index"`
+	Language        string `gorm:"size:16"`
+	Word            string `gorm:"type:text"`
+	Translation     string `gorm:"type:text"`
+	Example         string `gorm:"type:text"`
+	ExampleMeaning  string `gorm:"type:text"`
+}
+
+// WordOfTheDayPost records a word posted as word of the day.
+type WordOfTheDayPost struct {
+	gorm.Model
+	DiscordServerID uint   `gorm:"index"`
+	Origin          string `gorm:"size:16"`
+	OriginID        uint
+	PostedDate      string `gorm:"size:10"`
+	MessageID       string `gorm:"size:32"`
+}
+
+// WordOfTheDay is a word ready to post.
+type WordOfTheDay struct {
+	Origin         string
+	OriginID       uint
+	Word           string
+	Translation    string
+	Example        string
+	ExampleMeaning string
+}
+
+// Location returns the time zone of a config, UTC if it has none or it is unknown.
+func (c *WordOfTheDayConfig) Location() *time.Location {
+	if loc, err := time.LoadLocation(c.Timezone); err == nil && c.Timezone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// GetWordOfTheDayConfig returns a server's word of the day settings, with defaults if it has none yet.
+func (h *Handler) GetWordOfTheDayConfig(guildID uint) *WordOfTheDayConfig {
+	var configs []WordOfTheDayConfig
+	h.db.Where("discord_server_id = ?", guildID).Limit(1).Find(&configs)
+	if len(configs) == 0 {
+		return &WordOfTheDayConfig{DiscordServerID: guildID, PostTime: "09:00", Timezone: "UTC"}
+	}
+	return &configs[0]
+}
+
+// SaveWordOfTheDayConfig saves a server's word of the day settings, with the post time as HH:MM.
+//
+// @param config: The settings to save.
+// @return error: An error if the post time is not a time of day or the settings could not be saved.
+func (h *Handler) SaveWordOfTheDayConfig(config *WordOfTheDayConfig) error {
+	postTime, err := time.Parse("15:04", config.PostTime)
+	if err != nil {
+		return fmt.Errorf("post time '%s' is not HH:MM", config.PostTime)
+	}
+	config.PostTime = postTime.Format("15:04")
+	return h.db.Save(config).Error
+}
+
+// GetEnabledWordOfTheDayConfigs returns the settings of every server with word of the day on.
+func (h *Handler) GetEnabledWordOfTheDayConfigs() ([]WordOfTheDayConfig, error) {
+	var configs []WordOfTheDayConfig
+	res := h.db.Where("enabled = ?", true).Find(&configs)
+	return configs, res.Error
+}
+
+// ClaimWordOfTheDay marks a server's word of the day as posted for date.
+// It returns false if the server already posted on that date, so a post is never made twice,
+// even across restarts.
+//
+// @param configID: The ID of the config row.
+// @param date: The server's local date, YYYY-MM-DD.
+// @return bool: Whether the caller should post.
+// @return error: An error if the config could not be updated.
+func (h *Handler) ClaimWordOfTheDay(configID uint, date string) (bool, error) {
+	res := h.db.Model(&WordOfTheDayConfig{}).Where("id = ? AND (last_posted_date IS NULL OR last_posted_date <> ?)", configID, date).
+		Update("last_posted_date", date)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ImportWordList adds words to a server's word list.
+//
+// @param entries: The words to add.
+// @return error: An error if the words could not be saved.
+func (h *Handler) ImportWordList(entries []WordListEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return h.db.CreateInBatches(entries, 100).Error
+}
+
+// CountWordList returns how many words a server's word list has in lang.
+func (h *Handler) CountWordList(guildID uint, lang string) int64 {
+	var count int64
+	h.db.Model(&WordListEntry{}).Where("discord_server_id = ? AND language = ?", guildID, lang).Count(&count)
+	return count
+}
+
+// ClearWordList deletes a server's word list in lang.
+func (h *Handler) ClearWordList(guildID uint, lang string) error {
+	return h.db.Unscoped().Where("discord_server_id = ? AND language = ?", guildID, lang).Delete(&WordListEntry{}).Error
+}
+
+// PickWordOfTheDay returns the word the server has gone longest without posting, taken from its word list
+// and its phrasebook in lang. Words never posted come first.
+//
+// @param guildID: The server's ID
+// @param lang: The language the words are taught in.
+// @return *WordOfTheDay: The word, nil if the server has no words in lang.
+// @return error: An error if the words could not be read.
+func (h *Handler) PickWordOfTheDay(guildID uint, lang string) (*WordOfTheDay, error) {
+	var candidates []WordOfTheDay
+	var words []WordListEntry
+	if res := h.db.Where("discord_server_id = ? AND language = ?", guildID, lang).Order("id").Find(&words); res.Error != nil {
+		return nil, res.Error
+	}
+	for _, w := range words {
+		candidates = append(candidates, WordOfTheDay{Origin: WordOriginWordList, OriginID: w.ID, Word: w.Word,
+			Translation: w.Translation, Example: w.Example, ExampleMeaning: w.ExampleMeaning})
+	}
+	phrases, err := h.GetPhrasebook(guildID, lang)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range phrases {
+		word := WordOfTheDay{Origin: WordOriginPhrasebook, OriginID: p.ID, Word: p.SourceText, Translation: p.TranslatedText}
+		if p.TargetLanguage == lang {
+			word.Word, word.Translation = p.TranslatedText, p.SourceText
+		}
+		candidates = append(candidates, word)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var posts []WordOfTheDayPost
+	if res := h.db.Where("discord_server_id = ?", guildID).Order("id").Find(&posts); res.Error != nil {
+		return nil, res.Error
+	}
+	lastPost := map[string]int{}
+	for n, p := range posts {
+		lastPost[fmt.Sprintf("%s:%d", p.Origin, p.OriginID)] = n + 1
+	}
+	best := 0
+	for n, c := range candidates {
+		if lastPost[fmt.Sprintf("%s:%d", c.Origin, c.OriginID)] < lastPost[fmt.Sprintf("%s:%d", candidates[best].Origin, candidates[best].OriginID)] {
+			best = n
+		}
+	}
+	return &candidates[best], nil
+}
+
+// RecordWordOfTheDay records a posted word so it is not picked again soon.
+func (h *Handler) RecordWordOfTheDay(guildID uint, word *WordOfTheDay, date, messageID string) {
+	post := WordOfTheDayPost{DiscordServerID: guildID, Origin: word.Origin, OriginID: word.OriginID,
+		PostedDate: date, MessageID: messageID}
+	if res := h.db.Create(&post); res.Error != nil {
+		fmt.Printf("dbStats::RecordWordOfTheDay::%s\n", res.Error.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package botdbStats
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// flushBatchSize is the most rows written in one transaction by Flush
+const flushBatchSize = 100
+
+// markStatsDirty queues the stats row for the next flush, lock must be held.
+func (h *Handler) markStatsDirty() {
+	h.dirtyStats = true
+}
+
+// markServerDirty queues a server row for the next flush, lock must be held.
+func (h *Handler) markServerDirty(guildID uint) {
+	h.dirtyServers[guildID] = true
+}
+
+// markUserDirty queues a user row for the next flush, lock must be held.
+func (h *Handler) markUserDirty(userID uint) {
+	h.dirtyUsers[userID] = true
+}
+
+// updateStats saves the named fields of the stats to the store now, lock must be held.
+// The row is queued as well so an older snapshot being flushed cannot undo the change.
+func (h *Handler) updateStats(fields ...string) error {
+	h.markStatsDirty()
+	return h.store.UpdateStats(h.stats, fields...)
+}
+
+// updateServer saves the named fields of a server to the store now, lock must be held.
+// The row is queued as well so an older snapshot being flushed cannot undo the change.
+func (h *Handler) updateServer(server *DiscordServer, fields ...string) error {
+	h.markServerDirty(server.ID)
+	return h.store.UpdateServer(server, fields...)
+}
+
+// Flush writes the stats, servers and users changed since the last flush to the store,
+// at most flushBatchSize rows per transaction. Rows that failed to save are kept for the next flush.
+//
+// @return error: An error if a batch could not be saved.
+func (h *Handler) Flush() error {
+	h.flushLock.Lock()
+	defer h.flushLock.Unlock()
+
+	h.lock.Lock()
+	var stats *GoogleTranslateStats
+	if h.dirtyStats {
+		s := *h.stats
+		s.TranslateSessions, s.BlacklistedUsers, s.Servers = nil, nil, nil
+		stats = &s
+	}
+	var servers []DiscordServer
+	for _, id := range sortedIDs(h.dirtyServers) {
+		if server := h.findServer(id); server != nil {
+			s := *server
+			s.Members, s.Phrasebook = nil, nil
+			servers = append(servers, s)
+		}
+	}
+	var users []DiscordUser
+	for _, id := range sortedIDs(h.dirtyUsers) {
+		if has, user, _ := h.stats.containsUser(id); has {
+			users = append(users, *user)
+		}
+	}
+	h.dirtyStats = false
+	clear(h.dirtyServers)
+	clear(h.dirtyUsers)
+	h.lock.Unlock()
+
+	// The stats and servers go first, users reference their server
+	for stats != nil || len(servers) > 0 || len(users) > 0 {
+		n := min(len(servers), flushBatchSize)
+		batchServers := servers[:n]
+		batchUsers := users[:min(len(users), flushBatchSize-n)]
+		if err := h.store.SaveChanges(stats, batchServers, batchUsers); err != nil {
+			h.requeue(stats, servers, users)
+			return err
+		}
+		stats, servers, users = nil, servers[n:], users[len(batchUsers):]
+	}
+	return nil
+}
+
+// sortedIDs returns the IDs of a dirty set in ascending order, so rows are always locked in the same order.
+func sortedIDs(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// requeue marks rows that were not saved dirty again.
+func (h *Handler) requeue(stats *GoogleTranslateStats, servers []DiscordServer, users []DiscordUser) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if stats != nil {
+		h.markStatsDirty()
+	}
+	for _, s := range servers {
+		h.markServerDirty(s.ID)
+	}
+	for _, u := range users {
+		h.markUserDirty(u.ID)
+	}
+}
+
+// RunWriteBehind flushes changed stats to the store on every tick of interval.
+//
+// @param interval: How often changes are flushed.
+func (h *Handler) RunWriteBehind(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := h.Flush(); err != nil {
+			fmt.Printf("dbStats::RunWriteBehind::%s\n", err.Error())
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package botFeedback
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+const upvoteEmoji = "👍"
+const downvoteEmoji = "👎"
+
+const defaultReportCount = 10
+const maxReportCount = 25
+
+// Handler serves the translation feedback commands, keeping the votes and corrections in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the translation feedback commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the translation feedback commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"translation": h.handleTranslationCommand,
+	}
+}
+
+var FeedbackHelpCmds = map[string]string{
+	"<translation>": "Admin: lowest rated translations and pending corrections '<translation reports [n]>', " +
+		"approve a correction '<translation approve <id>>', let a role correct directly '<translation trusted @role|none>'",
+}
+
+// Components returns the handlers of the correction button and form of translations, keyed by the first part of their custom ID.
+func (h *Handler) Components() map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	return map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+		"feedback": h.handleFeedbackComponent,
+	}
+}
+
+// ReplyComponents returns the buttons added under a bot translation.
+func ReplyComponents() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{Label: "Suggest correction", Style: discordgo.SecondaryButton, CustomID: "feedback:suggest"},
+	}}}
+}
+
+// AddVoteReactions adds the vote reactions to a bot translation so members can click them.
+func AddVoteReactions(s *discordgo.Session, channelID, messageID string) {
+	for _, emoji := range []string{upvoteEmoji, downvoteEmoji} {
+		if err := s.MessageReactionAdd(channelID, messageID, emoji); err != nil {
+			fmt.Println("AddVoteReactions: ", err)
+			return
+		}
+	}
+}
+
+// reactionVote returns the vote an emoji stands for, 0 if it is not a vote.
+func reactionVote(emoji string) int8 {
+	switch emoji {
+	case upvoteEmoji:
+		return 1
+	case downvoteEmoji:
+		return -1
+	}
+	return 0
+}
+
+// HandleReactionAdd stores a vote when a member reacts to a bot translation with a thumbs up or down.
+func (h *Handler) HandleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	vote := reactionVote(r.Emoji.Name)
+	if vote == 0 || r.UserID == s.State.User.ID || !h.stats.IsTranslationMessage(r.MessageID) {
+		return
+	}
+	userID, _ := strconv.ParseUint(r.UserID, 10, 64)
+	if err := h.stats.SetTranslationVote(r.MessageID, uint(userID), vote); err != nil {
+		fmt.Println("HandleReactionAdd: ", err)
+		return
+	}
+	// A member has one vote, so drop the opposite reaction
+	opposite := downvoteEmoji
+	if vote < 0 {
+		opposite = upvoteEmoji
+	}
+	s.MessageReactionRemove(r.ChannelID, r.MessageID, opposite, r.UserID)
+}
+
+// HandleReactionRemove removes a member's vote when they take back their reaction.
+func (h *Handler) HandleReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	vote := reactionVote(r.Emoji.Name)
+	if vote == 0 || r.UserID == s.State.User.ID {
+		return
+	}
+	userID, _ := strconv.ParseUint(r.UserID, 10, 64)
+	if err := h.stats.RemoveTranslationVote(r.MessageID, uint(userID), vote); err != nil {
+		fmt.Println("HandleReactionRemove: ", err)
+	}
+}
+
+// handleFeedbackComponent opens the correction form for 'feedback:suggest'
+// and stores the correction submitted with 'feedback:correct:<messageID>'.
+func (h *Handler) handleFeedbackComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		record := h.stats.GetTranslationByMessage(i.Message.ID)
+		current := ""
+		if record != nil {
+			current = record.OutputText
+		}
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "feedback:correct:" + i.Message.ID,
+				Title:    "Suggest a correction",
+				Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{CustomID: "correction", Label: "Better translation", Style: discordgo.TextInputParagraph,
+						Value: current, Required: true, MaxLength: 2000},
+				}}},
+			},
+		})
+		if err != nil {
+			fmt.Println("feedback: ", err)
+		}
+	case discordgo.InteractionModalSubmit:
+		data := i.ModalSubmitData()
+		messageID := strings.TrimPrefix(data.CustomID, "feedback:correct:")
+		text := modalValue(data.Components, "correction")
+		if strings.TrimSpace(text) == "" {
+			respondEphemeral(s, i, "The correction was empty.")
+			return
+		}
+		user := botUtils.InteractionUser(i)
+		userID, _ := strconv.ParseUint(user.ID, 10, 64)
+		trusted := h.isTrusted(s, i)
+		correction, err := h.stats.SuggestCorrection(messageID, uint(userID), text, trusted)
+		if errors.Is(err, botdbStats.ErrUnknownTranslation) {
+			respondEphemeral(s, i, "I can't find that translation anymore.")
+			return
+		}
+		if err != nil {
+			fmt.Println("feedback: ", err)
+			respondEphemeral(s, i, "Failed to save your correction.")
+			return
+		}
+		if trusted {
+			respondEphemeral(s, i, "Thanks! Your correction is now used for this text.")
+		} else {
+			respondEphemeral(s, i, fmt.Sprintf("Thanks! Your correction #%d was sent to the admins for review.", correction.ID))
+		}
+	}
+}
+
+// isTrusted reports whether the member in an interaction may correct translations without approval.
+func (h *Handler) isTrusted(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	if i.GuildID == "" || i.Member == nil {
+		return false
+	}
+	if botUtils.IsGuildAdmin(s, i.GuildID, i.Member.User.ID) {
+		return true
+	}
+	guildID, _ := strconv.ParseUint(i.GuildID, 10, 64)
+	role := h.stats.TrustedRole(uint(guildID))
+	return role != "" && slices.Contains(i.Member.Roles, role)
+}
+
+// modalValue returns the value of a text input in a submitted form.
+func modalValue(components []discordgo.MessageComponent, customID string) string {
+	for _, c := range components {
+		row, ok := c.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, rc := range row.Components {
+			if input, ok := rc.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, msg string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: msg, Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		fmt.Println("feedback: ", err)
+	}
+}
+
+func (h *Handler) handleTranslationCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'translation' Cmd")
+	if m.GuildID == "" || !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "translation")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <translation reports [n]>, <translation approve <id>> or <translation trusted @role|none>")
+		return
+	}
+	switch args[0] {
+	case "reports":
+		n := defaultReportCount
+		if len(args) > 1 {
+			if v, err := strconv.Atoi(args[1]); err == nil && v > 0 {
+				n = min(v, maxReportCount)
+			}
+		}
+		h.handleReports(s, m, guildID, n)
+	case "approve":
+		id, err := strconv.ParseUint(strings.TrimPrefix(strings.Join(args[1:], ""), "#"), 10, 64)
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Usage: <translation approve <id>>")
+			return
+		}
+		if err := h.stats.ApproveCorrection(uint(guildID), uint(id), uint(authorID)); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Failed to approve the correction: "+err.Error())
+			return
+		}
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Correction #%d approved, it is now used for that text.", id))
+	case "trusted":
+		if len(args) != 2 {
+			s.ChannelMessageSend(m.ChannelID, "Usage: <translation trusted @role|none>")
+			return
+		}
+		role := strings.TrimSuffix(strings.TrimPrefix(args[1], "<@&"), ">")
+		if role == "none" {
+			role = ""
+		}
+		if err := h.stats.SetTrustedRole(uint(guildID), role); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Failed to set the trusted role: "+err.Error())
+			return
+		}
+		if role == "" {
+			s.ChannelMessageSend(m.ChannelID, "Only admins' corrections are used directly now.")
+		} else {
+			s.ChannelMessageSend(m.ChannelID, "Corrections by <@&"+role+"> are now used directly.")
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Usage: <translation reports [n]>, <translation approve <id>> or <translation trusted @role|none>")
+	}
+	fmt.Println("End Cmd")
+}
+
+func (h *Handler) handleReports(s *discordgo.Session, m *discordgo.MessageCreate, guildID, n int) {
+	reports, err := h.stats.GetTranslationReports(uint(guildID), n)
+	if err != nil {
+		fmt.Println("translation reports: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to read the translation reports.")
+		return
+	}
+	pending, err := h.stats.GetPendingCorrections(uint(guildID), n)
+	if err != nil {
+		fmt.Println("translation reports: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to read the pending corrections.")
+		return
+	}
+	botUtils.ChannelMessageSendLong(s, m.ChannelID, FormatReports(reports, pending))
+}
+
+// FormatReports returns the lowest rated translations and the pending corrections as a string.
+func FormatReports(reports []botdbStats.TranslationFeedback, pending []botdbStats.TranslationCorrection) string {
+	str := "**Lowest rated translations**\n"
+	if len(reports) == 0 {
+		str += "No translations were downvoted.\n"
+	}
+	for _, r := range reports {
+		str += fmt.Sprintf("%s %d %s %d  %s→%s: %s\n→ %s\n", upvoteEmoji, r.Upvotes, downvoteEmoji, r.Downvotes,
+			r.SourceLanguage, r.TargetLanguage, oneLine(r.SourceText), oneLine(r.OutputText))
+	}
+	str += "\n**Pending corrections**\n"
+	if len(pending) == 0 {
+		str += "No corrections are waiting for review.\n"
+	}
+	for _, c := range pending {
+		str += fmt.Sprintf("#%d by <@%d> %s→%s: %s\n✗ %s\n✓ %s\n", c.ID, c.SuggestedByUserID,
+			c.SourceLanguage, c.TargetLanguage, oneLine(c.SourceText), oneLine(c.OriginalText), oneLine(c.CorrectedText))
+	}
+	return str
+}
+
+func oneLine(str string) string {
+	return strings.Join(strings.Fields(str), " ")
+}
@@ -0,0 +1,145 @@
+package botHistory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+const defaultHistoryCount = 10
+const maxHistoryCount = 50
+
+// Handler serves the translation history commands, reading the history kept in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the translation history commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the translation history commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"history": h.handleHistoryCommand,
+	}
+}
+
+var HistoryHelpCmds = map[string]string{
+	"<history>": "DM your last translations '<history [n]>' or search them '<history search <word>>'. " +
+		"Admin: '<history on|off>', Owner: '<history retention <days>>'",
+}
+
+// FormatHistory returns translations as a string with one translation per entry.
+func FormatHistory(records []botdbStats.TranslationRecord) string {
+	var str string
+	for _, r := range records {
+		str += fmt.Sprintf("[%s] %s→%s: %s\n→ %s\n\n", r.CreatedAt.Format(time.DateTime),
+			r.SourceLanguage, r.TargetLanguage, strings.TrimSpace(r.SourceText), strings.TrimSpace(r.OutputText))
+	}
+	return str
+}
+
+func (h *Handler) handleHistoryCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'history' Cmd")
+	args := botUtils.GetCmdArgs(m.Content, "history")
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "on", "off":
+			h.handleHistoryToggle(s, m, guildID, args[0] == "on")
+			return
+		case "retention":
+			h.handleHistoryRetention(s, m, args[1:])
+			return
+		case "search":
+			if len(args) < 2 {
+				s.ChannelMessageSend(m.ChannelID, "Usage: <history search <word>>")
+				return
+			}
+			records, err := h.stats.SearchUserHistory(uint(authorID), strings.Join(args[1:], " "), maxHistoryCount)
+			sendHistory(s, m, records, err, "No translations matched.")
+			return
+		}
+	}
+
+	n := defaultHistoryCount
+	if len(args) > 0 {
+		if v, err := strconv.Atoi(args[0]); err == nil && v > 0 {
+			n = min(v, maxHistoryCount)
+		}
+	}
+	records, err := h.stats.GetUserHistory(uint(authorID), n)
+	sendHistory(s, m, records, err, "You have no translation history.")
+	fmt.Println("End Cmd")
+}
+
+// sendHistory sends translations to the message author as a direct message.
+func sendHistory(s *discordgo.Session, m *discordgo.MessageCreate, records []botdbStats.TranslationRecord, err error, empty string) {
+	if err != nil {
+		fmt.Println("history: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to read your translation history.")
+		return
+	}
+	str := empty
+	if len(records) > 0 {
+		str = FormatHistory(records)
+	}
+	if err := botUtils.SendDM(s, m.Author.ID, str); err != nil {
+		fmt.Println("history: ", err)
+		s.ChannelMessageSend(m.ChannelID, "I couldn't DM you, please check your privacy settings.")
+		return
+	}
+	if m.GuildID != "" {
+		s.ChannelMessageSend(m.ChannelID, m.Author.Username+", I sent your history in a DM.")
+	}
+}
+
+func (h *Handler) handleHistoryToggle(s *discordgo.Session, m *discordgo.MessageCreate, guildID int, enabled bool) {
+	if m.GuildID == "" || !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	if err := h.stats.SetHistoryEnabled(uint(guildID), enabled); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to change translation history: "+err.Error())
+		return
+	}
+	if enabled {
+		s.ChannelMessageSend(m.ChannelID, "Translation history is on for this server.")
+	} else {
+		s.ChannelMessageSend(m.ChannelID, "Translation history is off for this server and its kept history was deleted.")
+	}
+}
+
+func (h *Handler) handleHistoryRetention(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if !botUtils.IsBotOwner(s, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Translation history is kept for %d days. Usage: <history retention <days>>",
+			int(h.stats.HistoryRetention().Hours()/24)))
+		return
+	}
+	days, err := strconv.ParseUint(args[0], 10, 32)
+	if err == nil && days > 0 {
+		err = h.stats.SetHistoryRetention(uint(days))
+	} else if err == nil {
+		err = fmt.Errorf("retention must be at least 1 day")
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to set history retention: "+err.Error())
+		return
+	}
+	h.stats.PruneHistory()
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Translation history is now kept for %d days.", days))
+}
@@ -0,0 +1,113 @@
+package botPartner
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Handler serves the language partner commands, keeping the opt-ins and matches in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the language partner commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the language partner commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"findpartner": h.handleFindPartnerCommand,
+	}
+}
+
+var PartnerHelpCmds = map[string]string{
+	"<findpartner>": "Opt in to language exchange matching '<findpartner on|off>', then '<findpartner>' finds a member " +
+		"translating the other way and introduces you both in DMs",
+}
+
+func (h *Handler) handleFindPartnerCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'findpartner' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "findpartner")
+	if len(args) > 0 && (args[0] == "on" || args[0] == "off") {
+		if err := h.stats.SetPartnerOptIn(uint(guildID), uint(authorID), args[0] == "on"); err != nil {
+			fmt.Println("findpartner: ", err)
+			s.ChannelMessageSend(m.ChannelID, "Failed to change your partner matching.")
+			return
+		}
+		if args[0] == "on" {
+			s.ChannelMessageSend(m.ChannelID, m.Author.Username+", you can now be matched with a language exchange partner. Use <findpartner> to look for one.")
+		} else {
+			s.ChannelMessageSend(m.ChannelID, m.Author.Username+", you will no longer be matched with language exchange partners.")
+		}
+		return
+	}
+
+	if !h.stats.IsPartnerOptedIn(uint(guildID), uint(authorID)) {
+		s.ChannelMessageSend(m.ChannelID, "Opt in with <findpartner on> first, only members who opted in are matched.")
+		return
+	}
+	partner, err := h.stats.FindPartner(uint(guildID), uint(authorID))
+	if err != nil {
+		fmt.Println("findpartner: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to look for a partner.")
+		return
+	}
+	if partner == nil {
+		s.ChannelMessageSend(m.ChannelID, m.Author.Username+", nobody new translates the other way yet. Try again later!")
+		return
+	}
+
+	partnerID := strconv.FormatUint(uint64(partner.User.ID), 10)
+	server := ""
+	if guild, err := s.State.Guild(m.GuildID); err == nil {
+		server = " in " + guild.Name
+	}
+	err = botUtils.SendDM(s, m.Author.ID, introduction(partnerID, server, partner.FromLang, partner.ToLang))
+	if err != nil {
+		fmt.Println("findpartner: ", err)
+		s.ChannelMessageSend(m.ChannelID, "I couldn't DM you, please check your privacy settings.")
+		return
+	}
+	if err := botUtils.SendDM(s, partnerID, introduction(m.Author.ID, server, partner.ToLang, partner.FromLang)); err != nil {
+		fmt.Println("findpartner: ", err)
+	}
+	if err := h.stats.RecordPartnerMatch(uint(guildID), uint(authorID), partner); err != nil {
+		fmt.Println("findpartner: ", err)
+	}
+	s.ChannelMessageSend(m.ChannelID, m.Author.Username+", I found you a partner, check your DMs!")
+	fmt.Println("End Cmd")
+}
+
+// introduction returns the DM introducing a partner to a user who translates from fromLang to toLang.
+func introduction(partnerID, server, fromLang, toLang string) string {
+	return fmt.Sprintf("Meet your language exchange partner <@%s>%s! You translate from %s to %s and they translate "+
+		"from %s to %s, so you can help each other. Say hello!", partnerID, server,
+		languageName(fromLang), languageName(toLang), languageName(toLang), languageName(fromLang))
+}
+
+// languageName returns the English name of a language code, or the code if it is unknown.
+func languageName(code string) string {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return code
+	}
+	if name := display.English.Languages().Name(tag); name != "" {
+		return name
+	}
+	return code
+}
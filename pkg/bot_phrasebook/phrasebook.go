@@ -0,0 +1,231 @@
+package botPhrasebook
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+// Handler serves the phrasebook commands, keeping the phrasebooks in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the phrasebook commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the phrasebook commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"save":       h.handleSaveCommand,
+		"phrasebook": h.handlePhrasebookCommand,
+	}
+}
+
+var PhrasebookHelpCmds = map[string]string{
+	"<save>": "Reply to a bot translation with '<save>' to add it to this server's phrasebook",
+	"<phrasebook>": "List the server phrasebook '<phrasebook [lang]>', remove a phrase '<phrasebook remove <id>>' " +
+		"or export it '<phrasebook export csv|anki [lang]>'",
+}
+
+func (h *Handler) handleSaveCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'save' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	if m.MessageReference == nil || m.MessageReference.MessageID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Reply to one of my translations with <save> to add it to the phrasebook.")
+		return
+	}
+	record := h.stats.GetTranslationByMessage(m.MessageReference.MessageID)
+	if record == nil || record.DiscordServerID != uint(guildID) {
+		s.ChannelMessageSend(m.ChannelID, "I can't find that translation, it may be too old to save.")
+		return
+	}
+
+	entry := &botdbStats.PhrasebookEntry{
+		DiscordServerID: uint(guildID),
+		SavedByUserID:   uint(authorID),
+		SourceLanguage:  record.SourceLanguage,
+		TargetLanguage:  record.TargetLanguage,
+		SourceText:      record.SourceText,
+		TranslatedText:  record.OutputText,
+	}
+	if err := h.stats.SavePhrase(entry); err != nil {
+		if errors.Is(err, botdbStats.ErrPhraseExists) {
+			s.ChannelMessageSend(m.ChannelID, "That translation is already in the phrasebook.")
+			return
+		}
+		fmt.Println("save: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to save the translation.")
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Saved to the phrasebook as #%d.", entry.ID))
+	fmt.Println("End Cmd")
+}
+
+func (h *Handler) handlePhrasebookCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'phrasebook' Cmd")
+	if m.GuildID == "" {
+		s.ChannelMessageSend(m.ChannelID, "Please use this command in a server.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "phrasebook")
+	if len(args) > 0 {
+		switch args[0] {
+		case "remove":
+			h.handlePhraseRemove(s, m, guildID, authorID, args[1:])
+			return
+		case "export":
+			h.handlePhrasebookExport(s, m, guildID, args[1:])
+			return
+		}
+	}
+
+	lang := ""
+	if len(args) > 0 {
+		lang = args[0]
+	}
+	entries, err := h.stats.GetPhrasebook(uint(guildID), lang)
+	if err != nil {
+		fmt.Println("phrasebook: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to read the phrasebook.")
+		return
+	}
+	if len(entries) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "The phrasebook is empty. Reply to a translation with <save> to add one.")
+		return
+	}
+	botUtils.ChannelMessageSendLong(s, m.ChannelID, FormatPhrasebook(entries))
+	fmt.Println("End Cmd")
+}
+
+// FormatPhrasebook returns phrases as a string with one phrase per line.
+func FormatPhrasebook(entries []botdbStats.PhrasebookEntry) string {
+	var str string
+	for _, e := range entries {
+		str += fmt.Sprintf("#%d %s→%s: %s = %s\n", e.ID, e.SourceLanguage, e.TargetLanguage,
+			oneLine(e.SourceText), oneLine(e.TranslatedText))
+	}
+	return str
+}
+
+func (h *Handler) handlePhraseRemove(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int, args []string) {
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <phrasebook remove <id>>")
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <phrasebook remove <id>>")
+		return
+	}
+	entry := h.stats.GetPhrase(uint(guildID), uint(id))
+	if entry == nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("There is no phrase #%d.", id))
+		return
+	}
+	if entry.SavedByUserID != uint(authorID) && !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Only the member who saved a phrase or an admin can remove it.")
+		return
+	}
+	if err := h.stats.RemovePhrase(uint(guildID), uint(id)); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to remove the phrase: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed phrase #%d.", id))
+}
+
+func (h *Handler) handlePhrasebookExport(s *discordgo.Session, m *discordgo.MessageCreate, guildID int, args []string) {
+	if len(args) == 0 || (args[0] != "csv" && args[0] != "anki") {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <phrasebook export csv|anki [lang]>")
+		return
+	}
+	lang := ""
+	if len(args) > 1 {
+		lang = args[1]
+	}
+	entries, err := h.stats.GetPhrasebook(uint(guildID), lang)
+	if err != nil {
+		fmt.Println("phrasebook export: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to read the phrasebook.")
+		return
+	}
+	if len(entries) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "The phrasebook has nothing to export.")
+		return
+	}
+
+	var file *discordgo.File
+	if args[0] == "csv" {
+		data, err := ExportCSV(entries)
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Failed to export the phrasebook.")
+			return
+		}
+		file = &discordgo.File{Name: "phrasebook.csv", ContentType: "text/csv", Reader: bytes.NewReader(data)}
+	} else {
+		file = &discordgo.File{Name: "phrasebook-anki.txt", ContentType: "text/tab-separated-values",
+			Reader: bytes.NewReader(ExportAnki(entries))}
+	}
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Phrasebook export, %d phrases", len(entries)),
+		Files:   []*discordgo.File{file},
+	})
+}
+
+// ExportCSV writes phrases as CSV with a header row.
+//
+// @param entries: The phrases to export.
+// @return []byte: The CSV file.
+// @return error: An error if the CSV could not be written.
+func ExportCSV(entries []botdbStats.PhrasebookEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "source_language", "target_language", "source", "translation", "saved_by", "saved_at"})
+	for _, e := range entries {
+		w.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10), e.SourceLanguage, e.TargetLanguage, e.SourceText, e.TranslatedText,
+			strconv.FormatUint(uint64(e.SavedByUserID), 10), e.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportAnki writes phrases as tab separated notes that Anki imports with front, back and tags fields.
+//
+// @param entries: The phrases to export.
+// @return []byte: The TSV file.
+func ExportAnki(entries []botdbStats.PhrasebookEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#separator:tab\n#html:false\n#tags column:3\n")
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%s\t%s\tphrasebook %s-%s\n", ankiField(e.SourceText), ankiField(e.TranslatedText),
+			e.SourceLanguage, e.TargetLanguage)
+	}
+	return buf.Bytes()
+}
+
+// ankiField removes the tabs and line breaks that would split an Anki note.
+func ankiField(str string) string {
+	return strings.NewReplacer("\t", " ", "\r", "", "\n", " ").Replace(strings.TrimSpace(str))
+}
+
+func oneLine(str string) string {
+	return strings.Join(strings.Fields(str), " ")
+}
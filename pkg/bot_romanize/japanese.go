@@ -0,0 +1,142 @@
+package botRomanize
+
+import (
+	"strings"
+	"unicode"
+)
+
+// hiragana maps each hiragana to its Hepburn romanization, katakana is folded onto hiragana first
+var hiragana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+var smallY = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+var smallVowel = map[rune]string{'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o"}
+
+var jaPunctuation = map[rune]string{
+	'。': ".", '、': ",", '「': "\"", '」': "\"", '『': "\"", '』': "\"",
+	'？': "?", '！': "!", '・': " ", '　': " ", '〜': "~", '（': "(", '）': ")",
+}
+
+// toHiragana folds katakana onto the matching hiragana.
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+// isKana reports whether r is hiragana or katakana.
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Hiragana, unicode.Katakana)
+}
+
+// kanaSyllable returns the romaji of the syllable starting at runes[i] and how many runes it used.
+func kanaSyllable(runes []rune, i int) (string, int) {
+	base, ok := hiragana[runes[i]]
+	if !ok {
+		return "", 0
+	}
+	if i+1 >= len(runes) {
+		return base, 1
+	}
+	next := runes[i+1]
+
+	// Contracted sounds such as きゃ kya, しょ sho and ちゅ chu
+	if v, ok := smallY[next]; ok && strings.HasSuffix(base, "i") && len(base) > 1 {
+		stem := strings.TrimSuffix(base, "i")
+		if strings.HasSuffix(stem, "sh") || strings.HasSuffix(stem, "ch") || stem == "j" {
+			return stem + v, 2
+		}
+		return stem + "y" + v, 2
+	}
+	// Extended katakana sounds such as ファ fa, ティ ti and ウィ wi
+	if v, ok := smallVowel[next]; ok && len(base) > 1 {
+		return base[:len(base)-1] + v, 2
+	}
+	if v, ok := smallVowel[next]; ok && base == "u" {
+		return "w" + v, 2
+	}
+	return base, 1
+}
+
+// Japanese converts the kana in text to Hepburn romaji.
+// Kanji have no reading without a dictionary and are left as they are.
+//
+// @param text: The Japanese text.
+// @return string: The text with its kana romanized.
+func Japanese(text string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = toHiragana(r)
+	}
+
+	var out strings.Builder
+	double := false // a small tsu doubles the next consonant
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == 'っ':
+			double = true
+			i++
+			continue
+		case r == 'ー':
+			// Long vowel mark repeats the previous vowel
+			str := out.String()
+			if len(str) > 0 && strings.ContainsRune("aiueo", rune(str[len(str)-1])) {
+				out.WriteByte(str[len(str)-1])
+			}
+			i++
+			continue
+		case r == 'ん':
+			out.WriteString("n")
+			if i+1 < len(runes) {
+				if syl, _ := kanaSyllable(runes, i+1); syl != "" && strings.ContainsRune("aiueoy", rune(syl[0])) {
+					out.WriteString("'")
+				}
+			}
+			i++
+			continue
+		}
+
+		syl, n := kanaSyllable(runes, i)
+		if n == 0 {
+			double = false
+			if p, ok := jaPunctuation[r]; ok {
+				out.WriteString(p)
+			} else {
+				out.WriteRune(r)
+			}
+			i++
+			continue
+		}
+		if double {
+			if strings.HasPrefix(syl, "ch") {
+				out.WriteByte('t')
+			} else if !strings.ContainsRune("aiueo", rune(syl[0])) {
+				out.WriteByte(syl[0])
+			}
+			double = false
+		}
+		out.WriteString(syl)
+		i += n
+	}
+	return out.String()
+}
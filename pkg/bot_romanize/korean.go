@@ -0,0 +1,76 @@
+package botRomanize
+
+import "strings"
+
+const hangulBase = 0xAC00
+const hangulLast = 0xD7A3
+
+// Revised Romanization of the initial, medial and final jamo in Unicode order
+var initials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+var medials = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+
+// finals are romanized at the end of a word or before a consonant
+var finals = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+
+// linkedFinals are romanized when the next syllable starts with the silent ㅇ and the final carries over
+var linkedFinals = []string{"", "g", "kk", "ks", "n", "nj", "n", "d", "r", "lg", "lm", "lb", "ls", "lt", "lp", "r", "m", "b", "ps", "s", "ss", "ng", "j", "ch", "k", "t", "p", ""}
+
+const finalRieul = 8
+const initialRieul = 5
+const initialSilent = 11
+
+// isHangul reports whether r is a precomposed Hangul syllable.
+func isHangul(r rune) bool {
+	return r >= hangulBase && r <= hangulLast
+}
+
+// jamo splits a Hangul syllable into its initial, medial and final indexes.
+func jamo(r rune) (int, int, int) {
+	code := int(r - hangulBase)
+	return code / 588, (code % 588) / 28, code % 28
+}
+
+// Korean converts Hangul syllables in text using the Revised Romanization of Korean.
+// Final consonants carry over to a following vowel and ㄹㄹ becomes ll,
+// other sound changes are not applied.
+//
+// @param text: The Korean text.
+// @return string: The romanized text.
+func Korean(text string) string {
+	runes := []rune(text)
+	var out strings.Builder
+	prevFinal := -1 // final of the previous rune, -1 if it was not Hangul
+	for i, r := range runes {
+		if !isHangul(r) {
+			out.WriteRune(r)
+			prevFinal = -1
+			continue
+		}
+		initial, medial, final := jamo(r)
+
+		switch {
+		case initial == initialRieul && prevFinal == finalRieul:
+			out.WriteString("l")
+		case initial == initialSilent && prevFinal > 0:
+			// The previous syllable's final was carried over as this initial
+		default:
+			out.WriteString(initials[initial])
+		}
+		out.WriteString(medials[medial])
+
+		if final != 0 {
+			nextSilent := false
+			if i+1 < len(runes) && isHangul(runes[i+1]) {
+				nextInitial, _, _ := jamo(runes[i+1])
+				nextSilent = nextInitial == initialSilent
+			}
+			if nextSilent {
+				out.WriteString(linkedFinals[final])
+			} else {
+				out.WriteString(finals[final])
+			}
+		}
+		prevFinal = final
+	}
+	return out.String()
+}
@@ -0,0 +1,103 @@
+package botRomanize
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var RomanizeCmds = map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+	"romanize": handleRomanizeCommand,
+}
+
+var RomanizeHelpCmds = map[string]string{
+	"<romanize>": "Write Japanese kana, Korean or Vietnamese text in Latin letters '<romanize> <text>'",
+}
+
+// Combining marks that only Vietnamese uses among the supported languages:
+// breve, horn, hook above and dot below
+var vietnameseMarks = []rune{'\u0306', '\u031B', '\u0309', '\u0323'}
+
+// Vietnamese strips the tone marks and diacritics from text and writes đ as d.
+//
+// @param text: The Vietnamese text.
+// @return string: The text without diacritics.
+func Vietnamese(text string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, text)
+	if err != nil {
+		return text
+	}
+	return strings.NewReplacer("đ", "d", "Đ", "D").Replace(stripped)
+}
+
+// ForLanguage romanizes text written in lang.
+// The bool is false if lang is not Japanese, Korean or Vietnamese.
+//
+// @param lang: The language text is written in.
+// @param text: The text to romanize.
+// @return string: The romanized text.
+// @return bool: Whether lang can be romanized.
+func ForLanguage(lang language.Tag, text string) (string, bool) {
+	base, _ := lang.Base()
+	switch base.String() {
+	case "ja":
+		return Japanese(text), true
+	case "ko":
+		return Korean(text), true
+	case "vi":
+		return Vietnamese(text), true
+	}
+	return "", false
+}
+
+// Detect guesses the language of text from its script.
+// The bool is false if text has no kana, Hangul or Vietnamese diacritics.
+//
+// @param text: The text to check.
+// @return language.Tag: The detected language.
+// @return bool: Whether a language was detected.
+func Detect(text string) (language.Tag, bool) {
+	for _, r := range text {
+		switch {
+		case isKana(r) || unicode.Is(unicode.Han, r):
+			return language.Japanese, true
+		case isHangul(r):
+			return language.Korean, true
+		case r == 'đ' || r == 'Đ':
+			return language.Vietnamese, true
+		}
+	}
+	for _, r := range norm.NFD.String(text) {
+		for _, mark := range vietnameseMarks {
+			if r == mark {
+				return language.Vietnamese, true
+			}
+		}
+	}
+	return language.Und, false
+}
+
+func handleRomanizeCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'romanize' Cmd")
+	text := botUtils.GetCmdText(m.Content)
+	if text == "" {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <romanize> <text>")
+		return
+	}
+	lang, ok := Detect(text)
+	if !ok {
+		s.ChannelMessageSend(m.ChannelID, "I can only romanize Japanese kana, Korean and Vietnamese.")
+		return
+	}
+	roman, _ := ForLanguage(lang, text)
+	s.ChannelMessageSend(m.ChannelID, roman)
+	fmt.Println("End Cmd")
+}
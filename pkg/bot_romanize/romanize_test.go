@@ -0,0 +1,91 @@
+package botRomanize
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestKorean(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"서울", "seoul"},
+		{"안녕하세요", "annyeonghaseyo"},
+		{"한국어", "hangugeo"}, // final carried over to a silent initial
+		{"읽어", "ilgeo"},     // double final carried over
+		{"달라", "dalla"},     // ㄹㄹ
+		{"설날", "seolnal"},   // other sound changes are not applied
+		{"한국 KOREA", "hanguk KOREA"},
+	}
+	for _, tt := range tests {
+		if got := Korean(tt.text); got != tt.want {
+			t.Errorf("Korean(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestJapanese(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ありがとう", "arigatou"},
+		{"きょう", "kyou"},
+		{"しゃしん", "shashin"},
+		{"じゃあね", "jaane"},
+		{"ちょっと", "chotto"},
+		{"きっぷ", "kippu"},
+		{"まっちゃ", "matcha"},
+		{"コーヒー", "koohii"},
+		{"ファン", "fan"},
+		{"ウィキ", "wiki"},
+		{"てんいん", "ten'in"},
+		{"こんや", "kon'ya"},
+		{"日本です。", "日本desu."}, // kanji are left as they are
+	}
+	for _, tt := range tests {
+		if got := Japanese(tt.text); got != tt.want {
+			t.Errorf("Japanese(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestVietnamese(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Tiếng Việt", "Tieng Viet"},
+		{"Đà Nẵng", "Da Nang"},
+		{"phở", "pho"},
+	}
+	for _, tt := range tests {
+		if got := Vietnamese(tt.text); got != tt.want {
+			t.Errorf("Vietnamese(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want language.Tag
+		ok   bool
+	}{
+		{"こんにちは", language.Japanese, true},
+		{"カタカナ", language.Japanese, true},
+		{"漢字", language.Japanese, true},
+		{"안녕하세요", language.Korean, true},
+		{"Đà Nẵng", language.Vietnamese, true},
+		{"phở", language.Vietnamese, true},
+		{"hello", language.Und, false},
+	}
+	for _, tt := range tests {
+		got, ok := Detect(tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Detect(%q) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
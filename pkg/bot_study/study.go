@@ -0,0 +1,211 @@
+package botStudy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botRomanize "github.com/xtraice/go-discord-bot/pkg/bot_romanize"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+)
+
+// Handler serves the flashcard commands, keeping the study cards in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the flashcard commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the flashcard commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"study": h.handleStudyCommand,
+	}
+}
+
+var StudyHelpCmds = map[string]string{
+	"<study>": "Review flashcards from your translations and the server phrasebook in DMs, '<study stats>' shows your progress",
+}
+
+// Components returns the handlers of the buttons of study cards, keyed by the first part of their custom ID.
+func (h *Handler) Components() map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	return map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+		"study": h.handleStudyComponent,
+	}
+}
+
+// grades are the answer buttons of a card and the SM-2 quality each one stands for.
+var grades = []struct {
+	label   string
+	quality int
+	style   discordgo.ButtonStyle
+}{
+	{"Again", 1, discordgo.DangerButton},
+	{"Hard", 3, discordgo.SecondaryButton},
+	{"Good", 4, discordgo.PrimaryButton},
+	{"Easy", 5, discordgo.SuccessButton},
+}
+
+func (h *Handler) handleStudyCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'study' Cmd")
+	args := botUtils.GetCmdArgs(m.Content, "study")
+	if _, err := h.stats.SyncStudyCards(uint(authorID)); err != nil {
+		fmt.Println("study: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to build your study cards.")
+		return
+	}
+
+	var msg *discordgo.MessageSend
+	if len(args) > 0 && args[0] == "stats" {
+		msg = &discordgo.MessageSend{Content: h.formatStats(uint(authorID))}
+	} else {
+		msg = h.nextCardMessage(uint(authorID), "")
+	}
+
+	channel, err := s.UserChannelCreate(m.Author.ID)
+	if err == nil {
+		_, err = s.ChannelMessageSendComplex(channel.ID, msg)
+	}
+	if err != nil {
+		fmt.Println("study: ", err)
+		s.ChannelMessageSend(m.ChannelID, "I couldn't DM you, please check your privacy settings.")
+		return
+	}
+	if m.GuildID != "" {
+		s.ChannelMessageSend(m.ChannelID, m.Author.Username+", I sent your study session in a DM.")
+	}
+	fmt.Println("End Cmd")
+}
+
+// handleStudyComponent shows a card's answer for 'study:show:<id>' and grades it for 'study:grade:<id>:<quality>'.
+func (h *Handler) handleStudyComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(parts) < 3 {
+		return
+	}
+	user := botUtils.InteractionUser(i)
+	if user == nil {
+		return
+	}
+	userID, _ := strconv.ParseUint(user.ID, 10, 64)
+	cardID, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+	card := h.stats.GetStudyCard(uint(userID), uint(cardID))
+	if card == nil {
+		updateMessage(s, i, &discordgo.MessageSend{Content: "That card no longer exists."})
+		return
+	}
+
+	switch parts[1] {
+	case "show":
+		updateMessage(s, i, answerMessage(card))
+	case "grade":
+		if len(parts) != 4 {
+			return
+		}
+		quality, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return
+		}
+		if err := h.stats.ReviewStudyCard(card, quality); err != nil {
+			fmt.Println("study: ", err)
+			updateMessage(s, i, &discordgo.MessageSend{Content: "Failed to save your answer."})
+			return
+		}
+		updateMessage(s, i, h.nextCardMessage(uint(userID),
+			fmt.Sprintf("Next review of that card in %s.\n\n", untilReview(card.DueAt))))
+	}
+}
+
+// nextCardMessage returns the user's next due card with a button to show its answer,
+// or when the next card is due if none is.
+func (h *Handler) nextCardMessage(userID uint, prefix string) *discordgo.MessageSend {
+	card, due := h.stats.NextStudyCard(userID)
+	if card == nil {
+		next := h.stats.NextStudyDue(userID)
+		if next.IsZero() {
+			return &discordgo.MessageSend{Content: prefix + "You have no cards yet. Translate something or save phrases to the phrasebook first."}
+		}
+		return &discordgo.MessageSend{Content: fmt.Sprintf("%sAll done! Your next card is due in %s.", prefix, untilReview(next))}
+	}
+	return &discordgo.MessageSend{
+		Content: fmt.Sprintf("%s**%s → %s** (%d due)\n%s", prefix, card.SourceLanguage, card.TargetLanguage, due, card.Front),
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Show answer", Style: discordgo.PrimaryButton, CustomID: fmt.Sprintf("study:show:%d", card.ID)},
+		}}},
+	}
+}
+
+// answerMessage returns a card with its answer and the buttons to grade it.
+func answerMessage(card *botdbStats.StudyCard) *discordgo.MessageSend {
+	content := fmt.Sprintf("**%s → %s**\n%s\n\n%s", card.SourceLanguage, card.TargetLanguage, card.Front, card.Back)
+	for _, side := range []struct{ lang, text string }{{card.SourceLanguage, card.Front}, {card.TargetLanguage, card.Back}} {
+		tag, err := language.Parse(side.lang)
+		if err != nil {
+			continue
+		}
+		if roman, ok := botRomanize.ForLanguage(tag, side.text); ok {
+			content += "\nRomanized: " + roman
+		}
+	}
+
+	var buttons []discordgo.MessageComponent
+	for _, g := range grades {
+		buttons = append(buttons, discordgo.Button{Label: g.label, Style: g.style,
+			CustomID: fmt.Sprintf("study:grade:%d:%d", card.ID, g.quality)})
+	}
+	return &discordgo.MessageSend{
+		Content:    content,
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}},
+	}
+}
+
+// updateMessage replaces the message holding the pressed button.
+func updateMessage(s *discordgo.Session, i *discordgo.InteractionCreate, msg *discordgo.MessageSend) {
+	components := msg.Components
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: msg.Content, Components: components},
+	})
+	if err != nil {
+		fmt.Println("study: ", err)
+	}
+}
+
+func (h *Handler) formatStats(userID uint) string {
+	total, due, learned := h.stats.StudyStats(userID)
+	str := fmt.Sprintf("Cards: %d, due now: %d, learned: %d", total, due, learned)
+	if next := h.stats.NextStudyDue(userID); due == 0 && !next.IsZero() {
+		str += fmt.Sprintf("\nNext card is due in %s.", untilReview(next))
+	}
+	return str
+}
+
+// untilReview returns the time left until t, rounded for display.
+func untilReview(t time.Time) string {
+	d := time.Until(t)
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
@@ -0,0 +1,167 @@
+package botSubtitle
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported file formats
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+	FormatTXT = "txt"
+)
+
+const utf8BOM = "\ufeff"
+
+var ErrUnsupportedFormat = errors.New("unsupported file type, use .srt, .vtt or .txt")
+var ErrNotText = errors.New("file is not UTF-8 text")
+
+// File is a parsed subtitle or text file. Only the text lines are translated,
+// every other line such as cue numbers and timings is written back unchanged.
+type File struct {
+	Format string
+	lines  []string
+	text   []int    // Indexes of the lines to translate
+	voice  []string // WebVTT voice tag of each text line, kept out of the translation
+	bom    bool
+	crlf   bool
+}
+
+// FormatOf returns the format of a file name from its extension.
+func FormatOf(name string) (string, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".srt":
+		return FormatSRT, nil
+	case ".vtt":
+		return FormatVTT, nil
+	case ".txt":
+		return FormatTXT, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Parse reads a subtitle or text file.
+//
+// @param name: The file name, its extension selects the format.
+// @param data: The file contents.
+// @return *File: The parsed file.
+// @return error: An error if the format is unsupported or the file is not text.
+func Parse(name string, data []byte) (*File, error) {
+	format, err := FormatOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(data) {
+		return nil, ErrNotText
+	}
+	content := string(data)
+	f := &File{Format: format}
+	if strings.HasPrefix(content, utf8BOM) {
+		f.bom = true
+		content = strings.TrimPrefix(content, utf8BOM)
+	}
+	if strings.Contains(content, "\r\n") {
+		f.crlf = true
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	f.lines = strings.Split(content, "\n")
+
+	switch format {
+	case FormatSRT:
+		f.parseCues(false)
+	case FormatVTT:
+		f.parseCues(true)
+	default:
+		for n, line := range f.lines {
+			if strings.TrimSpace(line) != "" {
+				f.text = append(f.text, n)
+			}
+		}
+	}
+	return f, nil
+}
+
+// parseCues marks the text lines of the cues, the lines after a timing line up to the next blank line.
+// The timing line is the first or second line of a block, after an optional cue number or identifier,
+// so a text line holding "-->" stays text. WebVTT NOTE, STYLE and REGION blocks and the header are not
+// cues and are kept as they are.
+func (f *File) parseCues(vtt bool) {
+	inCue := false
+	blockLine := 0 // Lines read of the current block
+	skipBlock := false
+	for n, line := range f.lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			inCue, blockLine, skipBlock = false, 0, false
+			continue
+		}
+		if blockLine == 0 && vtt && (n == 0 || strings.HasPrefix(trimmed, "NOTE") || trimmed == "STYLE" || trimmed == "REGION") {
+			skipBlock = true
+		}
+		blockLine++
+		switch {
+		case skipBlock:
+		case !inCue && blockLine <= 2 && strings.Contains(trimmed, "-->"):
+			inCue = true
+		case inCue:
+			f.text = append(f.text, n)
+			voice := ""
+			if vtt && strings.HasPrefix(trimmed, "<v") {
+				if end := strings.Index(line, ">"); end > 0 {
+					voice = line[:end+1]
+				}
+			}
+			f.voice = append(f.voice, voice)
+		}
+	}
+}
+
+// Texts returns the lines to translate, in file order.
+func (f *File) Texts() []string {
+	texts := make([]string, len(f.text))
+	for n, idx := range f.text {
+		texts[n] = f.lines[idx]
+		if n < len(f.voice) {
+			texts[n] = strings.TrimPrefix(texts[n], f.voice[n])
+		}
+	}
+	return texts
+}
+
+// CharCount returns the number of characters of the lines to translate.
+func (f *File) CharCount() int {
+	count := 0
+	for _, text := range f.Texts() {
+		count += utf8.RuneCountInString(text)
+	}
+	return count
+}
+
+// Render returns the file with its text lines replaced by translations, in the order of Texts.
+//
+// @param translations: The translated lines.
+// @return []byte: The translated file, keeping the original timings and line endings.
+func (f *File) Render(translations []string) []byte {
+	lines := make([]string, len(f.lines))
+	copy(lines, f.lines)
+	for n, idx := range f.text {
+		if n < len(translations) {
+			// A translated line must not break the cue it belongs to
+			lines[idx] = strings.Join(strings.Fields(translations[n]), " ")
+			if n < len(f.voice) {
+				lines[idx] = f.voice[n] + lines[idx]
+			}
+		}
+	}
+	content := strings.Join(lines, "\n")
+	if f.crlf {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	if f.bom {
+		content = utf8BOM + content
+	}
+	return []byte(content)
+}
@@ -0,0 +1,78 @@
+package botSubtitle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		texts []string
+		want  string // The file rendered with each text upper-cased
+	}{
+		{
+			name:  "cues.srt",
+			file:  "1\n00:00:01,000 --> 00:00:02,000\nHello\nworld\n\n2\n00:00:03,000 --> 00:00:04,000\nBye\n",
+			texts: []string{"Hello", "world", "Bye"},
+			want:  "1\n00:00:01,000 --> 00:00:02,000\nHELLO\nWORLD\n\n2\n00:00:03,000 --> 00:00:04,000\nBYE\n",
+		},
+		{
+			name:  "arrow.srt",
+			file:  "1\n00:00:01,000 --> 00:00:02,000\nthen --> now\n-->\n",
+			texts: []string{"then --> now", "-->"},
+			want:  "1\n00:00:01,000 --> 00:00:02,000\nTHEN --> NOW\n-->\n",
+		},
+		{
+			name:  "crlf.srt",
+			file:  "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nHi\r\n",
+			texts: []string{"Hi"},
+			want:  "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nHI\r\n",
+		},
+		{
+			name:  "cues.vtt",
+			file:  "WEBVTT\n\nNOTE a --> b\n\nintro\n00:01.000 --> 00:02.000\n<v Ann>Hello\n\n00:03.000 --> 00:04.000\na --> b\n",
+			texts: []string{"Hello", "a --> b"},
+			want:  "WEBVTT\n\nNOTE a --> b\n\nintro\n00:01.000 --> 00:02.000\n<v Ann>HELLO\n\n00:03.000 --> 00:04.000\nA --> B\n",
+		},
+		{
+			name:  "notes.txt",
+			file:  "one\n\ntwo --> three\n",
+			texts: []string{"one", "two --> three"},
+			want:  "ONE\n\nTWO --> THREE\n",
+		},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.name, []byte(tt.file))
+		if err != nil {
+			t.Errorf("Parse(%s): %v", tt.name, err)
+			continue
+		}
+		texts := f.Texts()
+		if !reflect.DeepEqual(texts, tt.texts) {
+			t.Errorf("Parse(%s) texts = %q, want %q", tt.name, texts, tt.texts)
+			continue
+		}
+		if got := string(f.Render(texts)); got != tt.file {
+			t.Errorf("%s rendered unchanged = %q, want %q", tt.name, got, tt.file)
+		}
+		upper := make([]string, len(texts))
+		for n, text := range texts {
+			upper[n] = strings.ToUpper(text)
+		}
+		if got := string(f.Render(upper)); got != tt.want {
+			t.Errorf("%s rendered = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	if _, err := Parse("movie.ass", []byte("text")); err != ErrUnsupportedFormat {
+		t.Errorf("Parse(movie.ass) error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+	if _, err := Parse("movie.srt", []byte{0xff, 0xfe}); err != ErrNotText {
+		t.Errorf("Parse of binary data error = %v, want %v", err, ErrNotText)
+	}
+}
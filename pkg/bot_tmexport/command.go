@@ -0,0 +1,74 @@
+package botTmExport
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+)
+
+// Handler serves the translation memory export commands, reading the translations kept in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the translation memory export commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the translation memory export commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"tmexport": h.handleTmExportCommand,
+	}
+}
+
+var TmExportHelpCmds = map[string]string{
+	"<tmexport>": "Admin: export this server's translations for CAT tools " +
+		"'<tmexport tmx|xliff [src=<lang>] [tgt=<lang>] [since=YYYY-MM-DD] [until=YYYY-MM-DD]>'",
+}
+
+const tmExportUsage = "Usage: <tmexport tmx|xliff [src=<lang>] [tgt=<lang>] [since=YYYY-MM-DD] [until=YYYY-MM-DD]>"
+
+func (h *Handler) handleTmExportCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'tmexport' Cmd")
+	if m.GuildID == "" || !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "tmexport")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, tmExportUsage)
+		return
+	}
+	filter := botdbStats.TMFilter{GuildID: uint(guildID)}
+	if err := ParseFilterArgs(&filter, args[1:]); err != nil {
+		s.ChannelMessageSend(m.ChannelID, err.Error()+"\n"+tmExportUsage)
+		return
+	}
+
+	var buf bytes.Buffer
+	count, err := h.Export(&buf, args[0], filter)
+	if err != nil {
+		fmt.Println("tmexport: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to export the translation memory: "+err.Error())
+		return
+	}
+	if count == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No kept translations match, nothing to export.")
+		return
+	}
+	name := fmt.Sprintf("translation-memory-%s.%s", time.Now().UTC().Format("20060102"), map[string]string{"tmx": "tmx", "xliff": "xlf"}[args[0]])
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Translation memory export, %d segments", count),
+		Files:   []*discordgo.File{{Name: name, ContentType: "application/xml", Reader: &buf}},
+	})
+	fmt.Println("End Cmd")
+}
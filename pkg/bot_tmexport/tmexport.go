@@ -0,0 +1,244 @@
+package botTmExport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+)
+
+const toolName = "go-discord-bot"
+const toolVersion = "1.0"
+
+// tmxDateFormat is the UTC date format TMX uses
+const tmxDateFormat = "20060102T150405Z"
+
+// xmlLangNS makes encoding/xml write the xml:lang attribute
+const xmlLangNS = "http://www.w3.org/XML/1998/namespace"
+
+type tmxDoc struct {
+	XMLName xml.Name  `xml:"tmx"`
+	Version string    `xml:"version,attr"`
+	Header  tmxHeader `xml:"header"`
+	Units   []tmxUnit `xml:"body>tu"`
+}
+
+type tmxHeader struct {
+	CreationTool        string `xml:"creationtool,attr"`
+	CreationToolVersion string `xml:"creationtoolversion,attr"`
+	SegType             string `xml:"segtype,attr"`
+	OTmf                string `xml:"o-tmf,attr"`
+	AdminLang           string `xml:"adminlang,attr"`
+	SrcLang             string `xml:"srclang,attr"`
+	DataType            string `xml:"datatype,attr"`
+	CreationDate        string `xml:"creationdate,attr"`
+}
+
+type tmxUnit struct {
+	CreationDate string    `xml:"creationdate,attr"`
+	CreationID   string    `xml:"creationid,attr,omitempty"`
+	Props        []tmxProp `xml:"prop"`
+	Variants     []tmxTuv  `xml:"tuv"`
+}
+
+type tmxProp struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type tmxTuv struct {
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Seg  string `xml:"seg"`
+}
+
+type xliffDoc struct {
+	XMLName xml.Name    `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string      `xml:"version,attr"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr"`
+	DataType       string      `xml:"datatype,attr"`
+	Date           string      `xml:"date,attr"`
+	Tool           xliffTool   `xml:"header>tool"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffTool struct {
+	ID      string `xml:"tool-id,attr"`
+	Name    string `xml:"tool-name,attr"`
+	Version string `xml:"tool-version,attr"`
+}
+
+type xliffUnit struct {
+	ID     string      `xml:"id,attr"`
+	Source string      `xml:"source"`
+	Target xliffTarget `xml:"target"`
+}
+
+type xliffTarget struct {
+	State          string `xml:"state,attr"`
+	StateQualifier string `xml:"state-qualifier,attr,omitempty"`
+	Text           string `xml:",chardata"`
+}
+
+// WriteTMX writes segments as a TMX 1.4 document.
+// The header source language is the segments' common source language, or *all* if they differ.
+//
+// @param w: Where to write the document.
+// @param segments: The translation memory.
+// @return error: An error if the document could not be written.
+func WriteTMX(w io.Writer, segments []botdbStats.TMSegment) error {
+	srcLang := "*all*"
+	if len(segments) > 0 {
+		srcLang = segments[0].SourceLanguage
+		for _, seg := range segments {
+			if seg.SourceLanguage != srcLang {
+				srcLang = "*all*"
+				break
+			}
+		}
+	}
+	doc := tmxDoc{
+		Version: "1.4",
+		Header: tmxHeader{
+			CreationTool:        toolName,
+			CreationToolVersion: toolVersion,
+			SegType:             "sentence",
+			OTmf:                toolName,
+			AdminLang:           "en",
+			SrcLang:             srcLang,
+			DataType:            "plaintext",
+			CreationDate:        time.Now().UTC().Format(tmxDateFormat),
+		},
+	}
+	for _, seg := range segments {
+		unit := tmxUnit{
+			CreationDate: seg.CreatedAt.UTC().Format(tmxDateFormat),
+			Variants: []tmxTuv{
+				{Lang: seg.SourceLanguage, Seg: seg.Source},
+				{Lang: seg.TargetLanguage, Seg: seg.Target},
+			},
+		}
+		if seg.CreatedBy != 0 {
+			unit.CreationID = strconv.FormatUint(uint64(seg.CreatedBy), 10)
+		}
+		origin := "machine"
+		if seg.Corrected {
+			origin = "community-correction"
+		}
+		unit.Props = []tmxProp{{Type: "x-origin", Value: origin}}
+		doc.Units = append(doc.Units, unit)
+	}
+	return writeXML(w, `<!DOCTYPE tmx SYSTEM "tmx14.dtd">`+"\n", doc)
+}
+
+// WriteXLIFF writes segments as an XLIFF 1.2 document with one file element per language pair.
+// Machine translations are marked as MT suggestions and corrected ones as final.
+//
+// @param w: Where to write the document.
+// @param original: The name of the source the segments came from.
+// @param segments: The translation memory.
+// @return error: An error if the document could not be written.
+func WriteXLIFF(w io.Writer, original string, segments []botdbStats.TMSegment) error {
+	doc := xliffDoc{Version: "1.2"}
+	files := map[[2]string]int{}
+	date := time.Now().UTC().Format(time.RFC3339)
+	for _, seg := range segments {
+		pair := [2]string{seg.SourceLanguage, seg.TargetLanguage}
+		n, ok := files[pair]
+		if !ok {
+			n = len(doc.Files)
+			files[pair] = n
+			doc.Files = append(doc.Files, xliffFile{
+				Original:       original,
+				SourceLanguage: seg.SourceLanguage,
+				TargetLanguage: seg.TargetLanguage,
+				DataType:       "plaintext",
+				Date:           date,
+				Tool:           xliffTool{ID: toolName, Name: toolName, Version: toolVersion},
+			})
+		}
+		target := xliffTarget{State: "translated", StateQualifier: "mt-suggestion", Text: seg.Target}
+		if seg.Corrected {
+			target = xliffTarget{State: "final", Text: seg.Target}
+		}
+		file := &doc.Files[n]
+		file.Units = append(file.Units, xliffUnit{ID: strconv.Itoa(len(file.Units) + 1), Source: seg.Source, Target: target})
+	}
+	return writeXML(w, "", doc)
+}
+
+func writeXML(w io.Writer, doctype string, doc any) error {
+	if _, err := io.WriteString(w, xml.Header+doctype); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ParseFilterArgs reads 'src=<lang>', 'tgt=<lang>', 'since=YYYY-MM-DD' and 'until=YYYY-MM-DD' arguments into filter.
+// The until date is included in the export.
+//
+// @param filter: The filter to fill in.
+// @param args: The arguments.
+// @return error: An error if an argument is unknown or a date is invalid.
+func ParseFilterArgs(filter *botdbStats.TMFilter, args []string) error {
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+		var err error
+		switch key {
+		case "src":
+			filter.SourceLanguage = value
+		case "tgt":
+			filter.TargetLanguage = value
+		case "since":
+			filter.Since, err = time.Parse(time.DateOnly, value)
+		case "until":
+			filter.Until, err = time.Parse(time.DateOnly, value)
+			filter.Until = filter.Until.AddDate(0, 0, 1)
+		default:
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+		if err != nil {
+			return fmt.Errorf("%s must be a date like 2024-01-31", key)
+		}
+	}
+	return nil
+}
+
+// Export writes the translation memory matching filter in format, "tmx" or "xliff".
+//
+// @param w: Where to write the document.
+// @param format: The document format.
+// @param filter: The translations to export.
+// @return int: The number of segments written.
+// @return error: An error if the format is unknown or the export failed.
+func (h *Handler) Export(w io.Writer, format string, filter botdbStats.TMFilter) (int, error) {
+	if format != "tmx" && format != "xliff" {
+		return 0, fmt.Errorf("unknown format %q, use tmx or xliff", format)
+	}
+	segments, err := h.stats.GetTranslationMemory(filter)
+	if err != nil {
+		return 0, err
+	}
+	if format == "tmx" {
+		return len(segments), WriteTMX(w, segments)
+	}
+	return len(segments), WriteXLIFF(w, fmt.Sprintf("discord-server-%d", filter.GuildID), segments)
+}
@@ -0,0 +1,218 @@
+package botTranslate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botSubtitle "github.com/xtraice/go-discord-bot/pkg/bot_subtitle"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+)
+
+// Limits of translated attachments
+const maxAttachmentSize = 512 * 1024
+const maxAttachmentChars = 50000
+
+// Limits of one provider call when translating a file in batches
+const batchMaxLines = 100
+const batchMaxChars = 5000
+
+// translateAttachment translates the subtitle or text file attached to a translate command and replies
+// with the translated file. The file's character count is checked against the user's quota and the budgets
+// before anything is sent to the provider.
+//
+// @param s: The discord session.
+// @param m: The message with the attachment.
+// @param guildID: The server's ID
+// @param authorID: The author's ID
+// @param fromLang: The source language.
+// @param toLang: The target language.
+func (h *Handler) translateAttachment(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int,
+	fromLang, toLang language.Tag) {
+	// New users get the server's default quotas before their quota is checked
+	if err := h.stats.EnsureMember(uint(guildID), uint(authorID), m.Author.Username); err != nil {
+		fmt.Println("translateAttachment: ", err)
+		return
+	}
+	roles := authorRoles(s, m)
+	if h.stats.ExceedsQuotaOrBanned(uint(guildID), uint(authorID), roles) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you have no translations left in your quota.")
+		return
+	}
+	attachment := m.Attachments[0]
+	if _, err := botSubtitle.FormatOf(attachment.Filename); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, I can only translate .srt, .vtt and .txt files.")
+		return
+	}
+	if attachment.Size > maxAttachmentSize {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Sorry, files up to %d KB can be translated.", maxAttachmentSize/1024))
+		return
+	}
+	data, err := downloadAttachment(s, attachment.URL)
+	if err != nil {
+		fmt.Println("translateAttachment: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to download the file.")
+		return
+	}
+	file, err := botSubtitle.Parse(attachment.Filename, data)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to read the file: "+err.Error())
+		return
+	}
+
+	chars := file.CharCount()
+	if chars == 0 {
+		s.ChannelMessageSend(m.ChannelID, "The file has no text to translate.")
+		return
+	}
+	if chars > maxAttachmentChars {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Sorry, the file has %d characters to translate, the limit is %d.",
+			chars, maxAttachmentChars))
+		return
+	}
+	if err := h.takeRateLimit(s, m, guildID, authorID, chars); err != nil {
+		return
+	}
+	if err := h.stats.ChargeUserQuota(uint(guildID), uint(authorID), roles, chars); err != nil {
+		h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+		left := h.stats.UserQuotaLeft(uint(guildID), uint(authorID), roles)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Sorry, the file has %d characters, you have %s left in your quota.",
+			chars, left))
+		return
+	}
+
+	client, ownKey, err := h.guildTranslateClient(uint(guildID))
+	if err != nil {
+		h.stats.RefundUserQuota(uint(guildID), uint(authorID), chars)
+		h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+		h.reportGuildKeyFailure(s, m, uint(guildID), err)
+		return
+	}
+	var translations []string
+	var billed int
+	if ownKey {
+		translations, billed, err = translateBatches(file.Texts(), func(batch []string, _ int) ([]string, error) {
+			return providerTranslateEach(client, h.ctx, batch, fromLang, toLang)
+		})
+	} else {
+		translations, billed, err = h.TranslateEach(h.ctx, uint(guildID), file.Texts(), fromLang, toLang)
+	}
+	if h.budgetWarnPending.Swap(false) {
+		botUtils.SendOwnerDM(s, "Translation budget soft-warning threshold reached\n"+h.stats.FormatBudget())
+	}
+	if err != nil {
+		// The batches translated before the error were billed and stay charged
+		h.stats.RefundUserQuota(uint(guildID), uint(authorID), chars-billed)
+		h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars-billed)
+	}
+	switch {
+	case errors.Is(err, botdbStats.ErrSymbolBudgetExceeded) || errors.Is(err, ErrNoPoolKey):
+		s.ChannelMessageSend(m.ChannelID, "Sorry, the monthly translation budget doesn't have enough left for this file.")
+		return
+	case errors.Is(err, botdbStats.ErrServerBudgetExceeded):
+		s.ChannelMessageSend(m.ChannelID, "Sorry, this server's translation budget doesn't have enough left for this file. See <serverbudget>.")
+		return
+	case err != nil:
+		s.ChannelMessageSend(m.ChannelID, "Failed to translate the file.")
+		return
+	}
+
+	ext := path.Ext(attachment.Filename)
+	name := strings.TrimSuffix(attachment.Filename, ext) + "." + toLang.String() + ext
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:   fmt.Sprintf("%s, here is your file translated from %s to %s (%d characters).", m.Author.Username, fromLang, toLang, chars),
+		Files:     []*discordgo.File{{Name: name, ContentType: "text/plain; charset=utf-8", Reader: bytes.NewReader(file.Render(translations))}},
+		Reference: m.Reference(),
+	})
+	if err != nil {
+		fmt.Println("translateAttachment: ", err)
+	}
+	h.stats.DiscordUserLangStatUpdate(*m, fromLang.String(), toLang.String())
+}
+
+func downloadAttachment(s *discordgo.Session, url string) ([]byte, error) {
+	resp, err := s.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize))
+}
+
+// translateBatches splits strs into batches the provider accepts and translates them in order with call.
+//
+// @param strs: The strings to translate.
+// @param call: Translates one batch of strings with the given character count.
+// @return []string: The translations, in the order of strs.
+// @return int: The characters of the batches that were translated, and so billed.
+// @return error: The first error of a batch, the translations of earlier batches are dropped.
+func translateBatches(strs []string, call func(batch []string, chars int) ([]string, error)) ([]string, int, error) {
+	billed := 0
+	translations := make([]string, 0, len(strs))
+	for start := 0; start < len(strs); {
+		end, chars := start, 0
+		for end < len(strs) && end-start < batchMaxLines {
+			n := utf8.RuneCountInString(strs[end])
+			if end > start && chars+n > batchMaxChars {
+				break
+			}
+			chars += n
+			end++
+		}
+		batch, err := call(strs[start:end], chars)
+		if err != nil {
+			return nil, billed, err
+		}
+		billed += chars
+		if len(batch) != end-start {
+			return nil, billed, fmt.Errorf("provider returned %d translations for %d lines", len(batch), end-start)
+		}
+		translations = append(translations, batch...)
+		start = end
+	}
+	return translations, billed, nil
+}
+
+// TranslateEach translates the strings through the key pool in batches and returns the translation of each one.
+// The whole file is reserved against the budgets before the first batch is sent, so a file is never cut off
+// halfway by the budget.
+//
+// @param ctx: The context for the translation.
+// @param guildID: The server's ID
+// @param strs: The strings to be translated.
+// @param srcTag: The source language tag.
+// @param tgtTag: The target language tag.
+// @return []string: The translations, in the order of strs.
+// @return int: The characters billed, settled against the budgets.
+// @return error: An error if the budget is too low or a batch fails.
+func (h *Handler) TranslateEach(ctx context.Context, guildID uint, strs []string, srcTag, tgtTag language.Tag) ([]string, int, error) {
+	estimate := 0
+	for _, str := range strs {
+		estimate += utf8.RuneCountInString(str)
+	}
+	reservation, err := h.stats.ReserveSymbols(guildID, estimate)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	translations, billed, err := translateBatches(strs, func(batch []string, chars int) ([]string, error) {
+		return h.pool.translateEach(ctx, batch, srcTag, tgtTag, chars)
+	})
+	if billed == 0 {
+		reservation.Release()
+	} else if reservation.Settle(billed) {
+		h.budgetWarnPending.Store(true)
+	}
+	return translations, billed, err
+}
@@ -0,0 +1,56 @@
+package botTranslate
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// translationCacheSize is how many recent translations are answered without calling the provider again
+const translationCacheSize = 1000
+
+// cacheKey identifies a translation of a text between two languages.
+type cacheKey struct {
+	from string
+	to   string
+	text string
+}
+
+var cacheLock = &sync.Mutex{}
+var translationCache_ = map[cacheKey]string{}
+var cacheOrder_ []cacheKey
+
+// cachedTranslation returns the translation of text if it is known without calling the provider.
+// An approved correction of the server wins over a cached provider translation.
+//
+// @param guildID: The server's ID
+// @param fromLang: The source language.
+// @param toLang: The target language.
+// @param text: The source text.
+// @return string: The translation.
+// @return bool: Whether the translation was known.
+func (h *Handler) cachedTranslation(guildID uint, fromLang, toLang language.Tag, text string) (string, bool) {
+	if corrected, ok := h.stats.GetCorrection(guildID, fromLang.String(), toLang.String(), text); ok {
+		return corrected + "\n", true
+	}
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	output, ok := translationCache_[cacheKey{fromLang.String(), toLang.String(), strings.TrimSpace(text)}]
+	return output, ok
+}
+
+// cacheTranslation remembers a provider translation, dropping the oldest once the cache is full.
+func cacheTranslation(fromLang, toLang language.Tag, text, output string) {
+	key := cacheKey{fromLang.String(), toLang.String(), strings.TrimSpace(text)}
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if _, ok := translationCache_[key]; !ok {
+		cacheOrder_ = append(cacheOrder_, key)
+	}
+	translationCache_[key] = output
+	if len(cacheOrder_) > translationCacheSize {
+		delete(translationCache_, cacheOrder_[0])
+		cacheOrder_ = cacheOrder_[1:]
+	}
+}
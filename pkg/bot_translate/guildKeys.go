@@ -0,0 +1,186 @@
+package botTranslate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/translate"
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+	"google.golang.org/api/option"
+)
+
+var ErrGuildKeyUnusable = errors.New("server api key can't be used")
+
+// guildTranslateClient returns the client for a server's own API key.
+// The bool is false when the server has no key and the global client must be used.
+// A key that can't be read is never replaced by the global client. One that can't be decrypted or used
+// fails every translation until it is set again, a failed read fails only the one translation.
+//
+// @param guildID: The server's ID
+// @return *translate.Client: The server's client.
+// @return bool: Whether the server uses its own key.
+// @return error: ErrGuildKeyUnusable if the server has a key that can't be used, the read error if it
+// could not be read now.
+func (h *Handler) guildTranslateClient(guildID uint) (*translate.Client, bool, error) {
+	h.guildClientsLock.Lock()
+	defer h.guildClientsLock.Unlock()
+	if client, ok := h.guildClients[guildID]; ok {
+		return client, client != nil, nil
+	}
+	if _, failed := h.guildKeyFailures[guildID]; failed {
+		return nil, false, ErrGuildKeyUnusable
+	}
+
+	apiKey, err := h.stats.GetGuildAPIKey(guildID)
+	if errors.Is(err, botdbStats.ErrKeyUndecryptable) || errors.Is(err, botdbStats.ErrKeyEncryptionUnset) {
+		fmt.Println("failed to decrypt server api key: ", err)
+		h.guildKeyFailures[guildID] = false
+		return nil, false, ErrGuildKeyUnusable
+	}
+	if err != nil {
+		fmt.Println("failed to get server api key: ", err)
+		return nil, false, err
+	}
+	if apiKey == "" {
+		h.guildClients[guildID] = nil
+		return nil, false, nil
+	}
+	client, err := translate.NewClient(h.ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		fmt.Println("failed to get server translate client: ", err)
+		h.guildKeyFailures[guildID] = false
+		return nil, false, ErrGuildKeyUnusable
+	}
+	h.guildClients[guildID] = client
+	return client, true, nil
+}
+
+// dropGuildClient closes and forgets the cached client of a server so its key is read again.
+func (h *Handler) dropGuildClient(guildID uint) {
+	h.guildClientsLock.Lock()
+	defer h.guildClientsLock.Unlock()
+	if client := h.guildClients[guildID]; client != nil {
+		client.Close()
+	}
+	delete(h.guildClients, guildID)
+	delete(h.guildKeyFailures, guildID)
+}
+
+// reportGuildKeyFailure tells the channel that the server's key can't be used and, the first time,
+// asks the server's owner to set it again. A key that could not be read now only asks to try again.
+//
+// @param s: The discord session.
+// @param m: The message that asked for the translation.
+// @param guildID: The server's ID
+// @param err: The error of guildTranslateClient.
+func (h *Handler) reportGuildKeyFailure(s *discordgo.Session, m *discordgo.MessageCreate, guildID uint, err error) {
+	if !errors.Is(err, ErrGuildKeyUnusable) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, this server's translation API key could not be read. Please try again later.")
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, "Sorry, this server's translation API key can't be used. "+
+		"A server administrator needs to set it again with setkey or remove it with removekey.")
+
+	h.guildClientsLock.Lock()
+	notified, failed := h.guildKeyFailures[guildID]
+	if failed && !notified {
+		h.guildKeyFailures[guildID] = true
+	}
+	h.guildClientsLock.Unlock()
+	if !failed || notified {
+		return
+	}
+	guild, err := s.State.Guild(m.GuildID)
+	if err != nil {
+		if guild, err = s.Guild(m.GuildID); err != nil {
+			fmt.Println("reportGuildKeyFailure: ", err)
+			return
+		}
+	}
+	err = botUtils.SendDM(s, guild.OwnerID, fmt.Sprintf("The translation API key of %s can't be read, translations "+
+		"there are stopped. Please send me setkey %d <apikey> or removekey %d to use the bot's key.", guild.Name, guildID, guildID))
+	if err != nil {
+		fmt.Println("reportGuildKeyFailure: ", err)
+	}
+}
+
+// dmOnlyGuard removes key commands posted in a server channel so the key is not left in the open.
+// It returns true if the command came from a server channel.
+func dmOnlyGuard(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	if m.GuildID == "" {
+		return false
+	}
+	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	s.ChannelMessageSend(m.ChannelID, "This command only works in a direct message with the bot. "+
+		"If you posted a key here, please revoke it.")
+	return true
+}
+
+func (h *Handler) handleSetKeyCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'setkey' Cmd")
+	if dmOnlyGuard(s, m) {
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "setkey")
+	if len(args) != 2 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: setkey <serverID> <apikey>")
+		return
+	}
+	gid, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || !botUtils.IsGuildAdmin(s, args[0], m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you need to be an administrator of that server.")
+		return
+	}
+
+	// Check the key works before storing it, listing languages is not billed
+	client, err := translate.NewClient(h.ctx, option.WithAPIKey(args[1]))
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to create a client with that key.")
+		return
+	}
+	_, err = client.SupportedLanguages(h.ctx, language.English)
+	client.Close()
+	if err != nil {
+		fmt.Println("setkey: key check failed: ", err)
+		s.ChannelMessageSend(m.ChannelID, "That key was rejected by the translation provider.")
+		return
+	}
+
+	if err := h.stats.SetGuildAPIKey(uint(gid), uint(authorID), args[1]); err != nil {
+		fmt.Println("setkey: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to store the key.")
+		return
+	}
+	h.dropGuildClient(uint(gid))
+	s.ChannelMessageSend(m.ChannelID, "Key saved. Translations in that server now use it and no longer count against the bot's monthly cap.")
+	fmt.Println("End Cmd")
+}
+
+func (h *Handler) handleRemoveKeyCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'removekey' Cmd")
+	if dmOnlyGuard(s, m) {
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "removekey")
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: removekey <serverID>")
+		return
+	}
+	gid, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || !botUtils.IsGuildAdmin(s, args[0], m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you need to be an administrator of that server.")
+		return
+	}
+	if err := h.stats.RemoveGuildAPIKey(uint(gid)); err != nil {
+		fmt.Println("removekey: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to remove the key.")
+		return
+	}
+	h.dropGuildClient(uint(gid))
+	s.ChannelMessageSend(m.ChannelID, "Key removed. Translations in that server use the bot's key again.")
+	fmt.Println("End Cmd")
+}
@@ -0,0 +1,208 @@
+package botTranslate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/translate"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	"golang.org/x/text/language"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// How long a key is skipped after the provider rejects it
+const quotaCooldown = time.Hour
+const authCooldown = 24 * time.Hour
+
+var ErrNoPoolKey = errors.New("no api key in the pool has budget left")
+
+// PoolKey is one provider API key of the bot as configured in the bot credentials.
+type PoolKey struct {
+	Name       string `json:"name"`
+	Key        string `json:"key"`
+	MonthlyCap uint64 `json:"monthlycap"` // 0 means the key has no cap of its own
+	ResetDay   int    `json:"resetday"`   // Day of month the key's usage resets, defaults to 1
+}
+
+type poolEntry struct {
+	client   *translate.Client
+	usage    *botdbStats.APIKeyUsage
+	reserved uint64
+}
+
+// keyPool routes provider calls to the key with the most budget left.
+type keyPool struct {
+	lock    sync.Mutex
+	stats   *botdbStats.Handler // Keeps the usage of each key
+	entries []*poolEntry
+}
+
+// newKeyPool creates a client for each configured key and loads its stored usage.
+func newKeyPool(ctx context.Context, stats *botdbStats.Handler, keys []PoolKey) (*keyPool, error) {
+	pool := &keyPool{stats: stats}
+	for i, key := range keys {
+		if key.Name == "" {
+			key.Name = fmt.Sprintf("key%d", i+1)
+		}
+		if key.ResetDay == 0 {
+			key.ResetDay = 1
+		}
+		client, err := translate.NewClient(ctx, option.WithAPIKey(key.Key))
+		if err != nil {
+			pool.close()
+			return nil, fmt.Errorf("key %s: %w", key.Name, err)
+		}
+		usage, err := stats.LoadAPIKeyUsage(key.Name, key.MonthlyCap, key.ResetDay)
+		if err != nil {
+			client.Close()
+			pool.close()
+			return nil, fmt.Errorf("key %s: %w", key.Name, err)
+		}
+		pool.entries = append(pool.entries, &poolEntry{client: client, usage: usage})
+	}
+	if len(pool.entries) == 0 {
+		return nil, errors.New("no api keys configured")
+	}
+	return pool, nil
+}
+
+func (p *keyPool) close() {
+	for _, e := range p.entries {
+		e.client.Close()
+	}
+}
+
+// remaining returns the symbols the key may still use this month, lock must be held.
+func (e *poolEntry) remaining() uint64 {
+	if e.usage.MonthlyCap == 0 {
+		return math.MaxUint64
+	}
+	used := e.usage.SymbolsUsed + e.reserved
+	if used >= e.usage.MonthlyCap {
+		return 0
+	}
+	return e.usage.MonthlyCap - used
+}
+
+// acquire reserves the estimate on the usable key with the most budget left, skipping tried keys.
+func (p *keyPool) acquire(estimate uint64, tried map[*poolEntry]bool) *poolEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var best *poolEntry
+	for _, e := range p.entries {
+		if botdbStats.ResetAPIKeyUsageIfDue(e.usage) {
+			p.stats.SaveAPIKeyUsage(e.usage)
+		}
+		if tried[e] || time.Now().Before(e.usage.CooldownUntil) || e.remaining() < estimate {
+			continue
+		}
+		if best == nil || e.remaining() > best.remaining() {
+			best = e
+		}
+	}
+	if best != nil {
+		best.reserved += estimate
+	}
+	return best
+}
+
+// finish settles a key's reservation with the symbols billed and pauses the key if it was rejected.
+func (p *keyPool) finish(e *poolEntry, estimate, actual uint64, cooldown time.Duration, cause error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	e.reserved -= min(e.reserved, estimate)
+	e.usage.SymbolsUsed += actual
+	if cooldown > 0 {
+		e.usage.CooldownUntil = time.Now().Add(cooldown)
+		e.usage.LastError = cause.Error()
+		fmt.Printf("keyPool: pausing key %s until %s: %s\n", e.usage.Name, e.usage.CooldownUntil, cause)
+	}
+	p.stats.SaveAPIKeyUsage(e.usage)
+}
+
+// rejectionCooldown returns how long to skip a key for an error that another key could avoid,
+// or 0 if the error is not about the key.
+func rejectionCooldown(err error) time.Duration {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return 0
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests:
+		return quotaCooldown
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if strings.Contains(strings.ToLower(apiErr.Message), "quota") {
+			return quotaCooldown
+		}
+		return authCooldown
+	case http.StatusBadRequest:
+		if strings.Contains(strings.ToLower(apiErr.Message), "api key") {
+			return authCooldown
+		}
+	}
+	return 0
+}
+
+// translate sends the strings through the pool, failing over to the next key on quota or auth errors.
+//
+// @param ctx: The context for the translation.
+// @param engStrs: The strings to be translated.
+// @param srcTag: The source language tag.
+// @param tgtTag: The target language tag.
+// @param charCnt: The number of symbols the call bills.
+// @return string: The translated string.
+// @return error: An error if every key failed or none has budget left.
+func (p *keyPool) translate(ctx context.Context, engStrs []string, srcTag, tgtTag language.Tag, charCnt int) (string, error) {
+	var resp string
+	err := p.do(charCnt, func(client *translate.Client) error {
+		var err error
+		resp, err = providerTranslate(client, ctx, engStrs, srcTag, tgtTag)
+		return err
+	})
+	if errors.Is(err, ErrNoPoolKey) {
+		return "", err
+	}
+	return resp, err
+}
+
+// translateEach is translate returning the translation of each string separately.
+func (p *keyPool) translateEach(ctx context.Context, engStrs []string, srcTag, tgtTag language.Tag, charCnt int) ([]string, error) {
+	var texts []string
+	err := p.do(charCnt, func(client *translate.Client) error {
+		var err error
+		texts, err = providerTranslateEach(client, ctx, engStrs, srcTag, tgtTag)
+		return err
+	})
+	return texts, err
+}
+
+// do runs call with the client of the key with the most budget left, failing over to the next key
+// on quota or auth errors.
+func (p *keyPool) do(charCnt int, call func(client *translate.Client) error) error {
+	tried := map[*poolEntry]bool{}
+	cost := uint64(charCnt)
+	for {
+		e := p.acquire(cost, tried)
+		if e == nil {
+			return ErrNoPoolKey
+		}
+		tried[e] = true
+		err := call(e.client)
+		if err == nil {
+			p.finish(e, cost, cost, 0, nil)
+			return nil
+		}
+		cooldown := rejectionCooldown(err)
+		p.finish(e, cost, 0, cooldown, err)
+		if cooldown == 0 {
+			return err
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package botTranslate
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+)
+
+// stickyKey identifies a user's sticky translation mode in one channel.
+type stickyKey struct {
+	userID    uint
+	channelID string
+}
+
+// stickyMode translates every message of a user in a channel until it is turned off or idles out.
+type stickyMode struct {
+	sessionID uint
+	fromLang  language.Tag
+	toLang    language.Tag
+	romanize  bool
+	timeout   time.Duration
+	lastUse   time.Time
+	count     uint64
+}
+
+// handleStickyToggle turns sticky mode on or off for '<jpen on>' and '<jpen off>'.
+// It returns false if the command is not a toggle.
+func (h *Handler) handleStickyToggle(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int,
+	fromLang, toLang language.Tag) bool {
+	args := strings.Fields(botUtils.GetCmd(m.Content))
+	if len(args) < 2 {
+		return false
+	}
+	key := stickyKey{userID: uint(authorID), channelID: m.ChannelID}
+	switch {
+	case slices.Contains(args[1:], "on"):
+		if m.GuildID == "" {
+			s.ChannelMessageSend(m.ChannelID, "Sticky translation only works in a server channel.")
+			return true
+		}
+		romanize := slices.ContainsFunc(args[1:], func(a string) bool { return slices.Contains(romanizeFlags, a) })
+		timeout := h.stats.StickyTimeout(uint(guildID))
+		if err := h.startSticky(key, uint(guildID), fromLang, toLang, romanize, timeout); err != nil {
+			fmt.Println("startSticky: ", err)
+			s.ChannelMessageSend(m.ChannelID, "Failed to turn on sticky translation.")
+			return true
+		}
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s, your messages here are now translated from %s to %s. "+
+			"Send <%s off> to stop, it also stops after %s idle.",
+			m.Author.Username, fromLang, toLang, args[0], timeout))
+		return true
+	case slices.Contains(args[1:], "off"):
+		if h.stopSticky(key) {
+			s.ChannelMessageSend(m.ChannelID, m.Author.Username+", sticky translation is off.")
+		}
+		return true
+	}
+	return false
+}
+
+// startSticky opens a sticky session for key, ending any mode the user already had in the channel.
+func (h *Handler) startSticky(key stickyKey, guildID uint, fromLang, toLang language.Tag, romanize bool, timeout time.Duration) error {
+	h.stopSticky(key)
+	id, err := h.stats.OpenStickySession(guildID, key.userID, key.channelID, fromLang.String(), toLang.String())
+	if err != nil {
+		return err
+	}
+	h.stickyLock.Lock()
+	defer h.stickyLock.Unlock()
+	h.stickyModes[key] = &stickyMode{
+		sessionID: id,
+		fromLang:  fromLang,
+		toLang:    toLang,
+		romanize:  romanize,
+		timeout:   timeout,
+		lastUse:   time.Now(),
+	}
+	return nil
+}
+
+// stopSticky ends the sticky mode of key and closes its session, returning false if there was none.
+func (h *Handler) stopSticky(key stickyKey) bool {
+	h.stickyLock.Lock()
+	mode, ok := h.stickyModes[key]
+	delete(h.stickyModes, key)
+	h.stickyLock.Unlock()
+	if !ok {
+		return false
+	}
+	if err := h.stats.CloseTranslateSession(mode.sessionID, mode.count); err != nil {
+		fmt.Println("stopSticky: ", err)
+	}
+	return true
+}
+
+// HandleStickyMessage translates a message that is not a command if its author has sticky mode on in its channel.
+// It returns true if the message was handled.
+//
+// @param s: The discord session.
+// @param m: The message.
+// @param guildID: The server's ID
+// @param authorID: The author's ID
+// @return bool: Whether the author has sticky mode on in the channel.
+func (h *Handler) HandleStickyMessage(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) bool {
+	key := stickyKey{userID: uint(authorID), channelID: m.ChannelID}
+	h.stickyLock.Lock()
+	mode, ok := h.stickyModes[key]
+	expired := ok && time.Since(mode.lastUse) > mode.timeout
+	if ok && !expired {
+		mode.lastUse = time.Now()
+	}
+	h.stickyLock.Unlock()
+	if !ok {
+		return false
+	}
+	if expired {
+		h.stopSticky(key)
+		return false
+	}
+
+	text := strings.TrimSpace(m.Content)
+	if text == "" {
+		return true
+	}
+	if h.translateAndReply(s, m, guildID, authorID, text, mode.fromLang, mode.toLang, mode.romanize) {
+		h.stickyLock.Lock()
+		mode.count++
+		h.stickyLock.Unlock()
+	}
+	return true
+}
+
+// expireStickyModes ends every sticky mode that has been idle longer than its timeout.
+func (h *Handler) expireStickyModes() {
+	h.stickyLock.Lock()
+	var expired []stickyKey
+	for key, mode := range h.stickyModes {
+		if time.Since(mode.lastUse) > mode.timeout {
+			expired = append(expired, key)
+		}
+	}
+	h.stickyLock.Unlock()
+	for _, key := range expired {
+		h.stopSticky(key)
+	}
+}
+
+// RunStickySweeper closes idle sticky sessions every interval.
+// Stale sessions from a previous run are closed first.
+//
+// @param interval: How often to check for idle sessions.
+func (h *Handler) RunStickySweeper(interval time.Duration) {
+	h.stats.CloseStaleStickySessions()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.expireStickyModes()
+	}
+}
+
+// StopAllSticky ends every sticky mode, closing their sessions on shutdown.
+func (h *Handler) StopAllSticky() {
+	h.stickyLock.Lock()
+	keys := make([]stickyKey, 0, len(h.stickyModes))
+	for key := range h.stickyModes {
+		keys = append(keys, key)
+	}
+	h.stickyLock.Unlock()
+	for _, key := range keys {
+		h.stopSticky(key)
+	}
+}
+
+func (h *Handler) handleStickyCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'sticky' Cmd")
+	if m.GuildID == "" || !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	args := botUtils.GetCmdArgs(m.Content, "sticky")
+	if len(args) != 2 || args[0] != "timeout" {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Sticky translation ends after %s idle. Usage: <sticky timeout <minutes>>",
+			h.stats.StickyTimeout(uint(guildID))))
+		return
+	}
+	minutes, err := strconv.ParseUint(args[1], 10, 32)
+	if err == nil && minutes > 0 {
+		err = h.stats.SetStickyTimeout(uint(guildID), uint(minutes))
+	} else if err == nil {
+		err = fmt.Errorf("timeout must be at least 1 minute")
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to set the sticky timeout: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Sticky translation now ends after %d idle minutes.", minutes))
+	fmt.Println("End Cmd")
+}
@@ -4,57 +4,113 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"cloud.google.com/go/translate"
 	"github.com/bwmarrin/discordgo"
 	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botFeedback "github.com/xtraice/go-discord-bot/pkg/bot_feedback"
+	botRomanize "github.com/xtraice/go-discord-bot/pkg/bot_romanize"
+	botSubtitle "github.com/xtraice/go-discord-bot/pkg/bot_subtitle"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
 	"golang.org/x/text/language"
-	"google.golang.org/api/option"
 )
 
-var gClient_ *translate.Client
-var botContext_ *context.Context
-
-var TranslateCmds = map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
-	"jpen": handleTranslateCommand(language.Japanese, language.English),
-	"enjp": handleTranslateCommand(language.English, language.Japanese),
-	"vien": handleTranslateCommand(language.Vietnamese, language.English),
-	"envi": handleTranslateCommand(language.English, language.Vietnamese),
-	"koen": handleTranslateCommand(language.Korean, language.English),
-	"enko": handleTranslateCommand(language.English, language.Korean),
-	"spen": handleTranslateCommand(language.Spanish, language.English),
-	"ensp": handleTranslateCommand(language.English, language.Spanish),
+// romanizeFlags attach a romanization under the translation
+var romanizeFlags = []string{"--romaji", "--roman"}
+
+// Cmds returns the translate commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"jpen":   h.handleTranslateCommand(language.Japanese, language.English),
+		"enjp":   h.handleTranslateCommand(language.English, language.Japanese),
+		"vien":   h.handleTranslateCommand(language.Vietnamese, language.English),
+		"envi":   h.handleTranslateCommand(language.English, language.Vietnamese),
+		"koen":   h.handleTranslateCommand(language.Korean, language.English),
+		"enko":   h.handleTranslateCommand(language.English, language.Korean),
+		"spen":   h.handleTranslateCommand(language.Spanish, language.English),
+		"ensp":   h.handleTranslateCommand(language.English, language.Spanish),
+		"sticky": h.handleStickyCommand,
+		// Direct message only commands
+		"setkey":    h.handleSetKeyCommand,
+		"removekey": h.handleRemoveKeyCommand,
+	}
 }
 
 var TranslateHelpCmds = map[string]string{
-	"<jpen>": "Translate Japanese to English",
-	"<enjp>": "Translate English to Japanese",
-	"<vien>": "Translate Vietnamese to English",
-	"<envi>": "Translate English to Vietnamese",
-	"<koen>": "Translate Korean to English",
-	"<enko>": "Translate English to Korean",
-	"<spen>": "Translate Spanish to English",
-	"<ensp>": "Translate English to Spanish",
+	"<jpen>":        "Translate Japanese to English",
+	"<enjp>":        "Translate English to Japanese",
+	"<vien>":        "Translate Vietnamese to English",
+	"<envi>":        "Translate English to Vietnamese",
+	"<koen>":        "Translate Korean to English",
+	"<enko>":        "Translate English to Korean",
+	"<spen>":        "Translate Spanish to English",
+	"<ensp>":        "Translate English to Spanish",
+	"<jpen> + file": "Attach a .srt, .vtt or .txt file to any translate command to get it back translated with the same timings",
+	"<setkey>":      "Admin, DM only: Use your server's own API key 'setkey <serverID> <apikey>'",
+	"<removekey>":   "Admin, DM only: Stop using your server's own API key 'removekey <serverID>'",
+}
+
+// Handler serves the translate commands, billing each translation to the quotas and budgets of the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+	ctx   context.Context
+	pool  *keyPool
+
+	// budgetWarnPending is set when a translation crosses the soft-warning threshold
+	// so the command handler can notify the bot owner.
+	budgetWarnPending atomic.Bool
+
+	// The clients of servers that use their own API key, nil when a server has none, and the servers whose key
+	// could not be used until it is set or removed again, true once the server's owner has been told
+	guildClientsLock sync.Mutex
+	guildClients     map[uint]*translate.Client
+	guildKeyFailures map[uint]bool
+
+	stickyLock  sync.Mutex
+	stickyModes map[stickyKey]*stickyMode
 }
 
-// InitTranslateClient initializes the translation client with the provided API key.
-// It returns an error if the client fails to initialize.
+// NewHandler initializes a translation client for each API key of the bot's key pool.
+// It returns an error if any client fails to initialize.
 //
-// @param botContext: The context for the bot.
-// @param apiKey: The API key for the translation service.
-// @return error: An error if the client fails to initialize.
-func InitTranslateClient(botContext *context.Context, apiKey string) error {
+// @param ctx: The context for the bot.
+// @param stats: The bot's stats, charged for each translation.
+// @param keys: The API keys for the translation service.
+// @return *Handler: The handler of the translate commands.
+// @return error: An error if the clients fail to initialize.
+func NewHandler(ctx context.Context, stats *botdbStats.Handler, keys []PoolKey) (*Handler, error) {
 	fmt.Println("Initializing Translate Client")
-	botContext_ = botContext
-	var err error
-	gClient_, err = translate.NewClient(*botContext_, option.WithAPIKey(apiKey))
+	pool, err := newKeyPool(ctx, stats, keys)
 	if err != nil {
 		fmt.Println("failed to get translate client: ", err)
-		return err
+		return nil, err
+	}
+	return &Handler{
+		stats:            stats,
+		ctx:              ctx,
+		pool:             pool,
+		guildClients:     map[uint]*translate.Client{},
+		guildKeyFailures: map[uint]bool{},
+		stickyModes:      map[stickyKey]*stickyMode{},
+	}, nil
+}
+
+// CloseTranslateClients closes the clients of the key pool and of servers using their own key.
+func (h *Handler) CloseTranslateClients() {
+	h.pool.close()
+	h.guildClientsLock.Lock()
+	defer h.guildClientsLock.Unlock()
+	for id, client := range h.guildClients {
+		if client != nil {
+			client.Close()
+		}
+		delete(h.guildClients, id)
 	}
-	defer gClient_.Close()
-	return nil
 }
 
 // handleTranslateCommand handles the translation command from one language to another.
@@ -64,61 +120,285 @@ func InitTranslateClient(botContext *context.Context, apiKey string) error {
 // @param fromLang: The source language.
 // @param toLang: The target language.
 // @return func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int): The translation command handler function.
-func handleTranslateCommand(fromLang, toLang language.Tag) func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+func (h *Handler) handleTranslateCommand(fromLang, toLang language.Tag) func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
 	return func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
 		fmt.Println("Got", fromLang, "Cmd")
-		if enStr := strings.TrimLeft(m.Content, "<"+fromLang.String()+">"); len(enStr) > 0 {
-			strSlice := []string{enStr}
-			if !botdbStats.ExceedsQuotaOrBanned(uint(guildID), uint(authorID)) {
-				if botContext_ == nil {
-					fmt.Println("botContext_ is nil")
-					return
-				}
-				respStr, _ := Translate(gClient_, *botContext_, strSlice, fromLang, toLang)
-
-				s.ChannelMessageSend(m.ChannelID, respStr)
-				botdbStats.DiscordUserLangStatUpdate(*m, fromLang.String(), toLang.String())
+		if h.handleStickyToggle(s, m, guildID, authorID, fromLang, toLang) {
+			return
+		}
+		enStr, romanize := parseTranslateInput(m.Content)
+		// Other attachments such as images may come with text to translate
+		if len(m.Attachments) > 0 {
+			if _, err := botSubtitle.FormatOf(m.Attachments[0].Filename); err == nil || len(enStr) == 0 {
+				h.translateAttachment(s, m, guildID, authorID, fromLang, toLang)
+				return
 			}
+		}
+		if len(enStr) > 0 {
+			h.translateAndReply(s, m, guildID, authorID, enStr, fromLang, toLang, romanize)
 			return
 		}
 	}
 }
 
-// Translate performs the translation using the provided translation client and context.
+// translateAndReply translates text for the message author and sends the result to the message's channel.
+// Quota, ban and budget checks are applied and the author's stats are updated.
+//
+// @param s: The discord session.
+// @param m: The message that asked for the translation.
+// @param guildID: The server's ID
+// @param authorID: The author's ID
+// @param text: The text to translate.
+// @param fromLang: The source language.
+// @param toLang: The target language.
+// @param romanize: Whether to add a romanization under the translation.
+// @return bool: Whether a translation was sent.
+func (h *Handler) translateAndReply(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int,
+	text string, fromLang, toLang language.Tag, romanize bool) bool {
+	// New users get the server's default quotas before their quota is checked
+	if err := h.stats.EnsureMember(uint(guildID), uint(authorID), m.Author.Username); err != nil {
+		fmt.Println("translateAndReply: ", err)
+		return false
+	}
+	roles := authorRoles(s, m)
+	if h.stats.ExceedsQuotaOrBanned(uint(guildID), uint(authorID), roles) {
+		return false
+	}
+	chars := utf8.RuneCountInString(text)
+	if err := h.takeRateLimit(s, m, guildID, authorID, chars); err != nil {
+		return false
+	}
+	strSlice := []string{text}
+	// Cached translations are not billed by the provider, so they don't count against the author's quota
+	respStr, cached := h.cachedTranslation(uint(guildID), fromLang, toLang, text)
+	var err error
+	if !cached {
+		if err := h.stats.ChargeUserQuota(uint(guildID), uint(authorID), roles, chars); err != nil {
+			h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+			fmt.Println("translateAndReply: ", err)
+			return false
+		}
+		client, ownKey, keyErr := h.guildTranslateClient(uint(guildID))
+		if keyErr != nil {
+			h.stats.RefundUserQuota(uint(guildID), uint(authorID), chars)
+			h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+			h.reportGuildKeyFailure(s, m, uint(guildID), keyErr)
+			return false
+		}
+		if ownKey {
+			respStr, err = providerTranslate(client, h.ctx, strSlice, fromLang, toLang)
+		} else {
+			respStr, err = h.Translate(h.ctx, uint(guildID), strSlice, fromLang, toLang)
+		}
+		if err == nil {
+			cacheTranslation(fromLang, toLang, text, respStr)
+		} else {
+			h.stats.RefundUserQuota(uint(guildID), uint(authorID), chars)
+			h.stats.ReturnRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+		}
+	}
+	if h.budgetWarnPending.Swap(false) {
+		botUtils.SendOwnerDM(s, "Translation budget soft-warning threshold reached\n"+h.stats.FormatBudget())
+	}
+	if errors.Is(err, botdbStats.ErrSymbolBudgetExceeded) || errors.Is(err, ErrNoPoolKey) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, the monthly translation budget has been used up.")
+		return false
+	}
+	if errors.Is(err, botdbStats.ErrServerBudgetExceeded) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, this server has used up its translation budget for the month. See <serverbudget>.")
+		return false
+	}
+
+	output := respStr
+	if romanize && err == nil {
+		respStr += romanization(fromLang, toLang, text, respStr)
+	}
+
+	if err != nil {
+		fmt.Println("translateAndReply: ", err)
+		s.ChannelMessageSend(m.ChannelID, "Sorry, the translation failed. Please try again later.")
+		return false
+	}
+	reply, sendErr := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:    respStr,
+		Components: botFeedback.ReplyComponents(),
+	})
+	h.stats.DiscordUserLangStatUpdate(*m, fromLang.String(), toLang.String())
+	if sendErr == nil {
+		h.stats.RecordTranslation(&botdbStats.TranslationRecord{
+			DiscordUserID:   uint(authorID),
+			DiscordServerID: uint(guildID),
+			ChannelID:       m.ChannelID,
+			MessageID:       reply.ID,
+			SourceLanguage:  fromLang.String(),
+			TargetLanguage:  toLang.String(),
+			SourceText:      text,
+			OutputText:      strings.TrimSpace(output),
+		})
+		botFeedback.AddVoteReactions(s, m.ChannelID, reply.ID)
+	}
+	return true
+}
+
+// takeRateLimit takes a translation's characters from the author's, the channel's and the server's rate limits
+// and tells the author when to try again if one of them has too little room.
+//
+// @param s: The discord session.
+// @param m: The message that asked for the translation.
+// @param guildID: The server's ID
+// @param authorID: The author's ID
+// @param chars: The characters to be translated.
+// @return error: The rate limit error, nil if the translation may go ahead.
+func (h *Handler) takeRateLimit(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int, chars int) error {
+	err := h.stats.TakeRateLimit(uint(guildID), m.ChannelID, uint(authorID), chars)
+	var limited *botdbStats.RateLimitError
+	if errors.As(err, &limited) {
+		who := map[string]string{
+			botdbStats.RateScopeUser:    "you are",
+			botdbStats.RateScopeChannel: "this channel is",
+			botdbStats.RateScopeGuild:   "this server is",
+		}[limited.Scope]
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Slow down, %s translating too fast. Try again in %s.", who, limited.RetryAfter))
+	}
+	return err
+}
+
+// authorRoles returns the roles the author of a message holds in its server.
+func authorRoles(s *discordgo.Session, m *discordgo.MessageCreate) []string {
+	if m.Member != nil {
+		return m.Member.Roles
+	}
+	return botUtils.MemberRoles(s, m.GuildID, m.Author.ID)
+}
+
+// parseTranslateInput returns the text of a translate command and whether a romanization was requested.
+// The romanize flags may be given inside the command brackets or before the text.
+//
+// @param content: The message content.
+// @return string: The text to translate.
+// @return bool: Whether --romaji or --roman was given.
+func parseTranslateInput(content string) (string, bool) {
+	romanize := false
+	if args := strings.Fields(botUtils.GetCmd(content)); len(args) > 1 {
+		for _, arg := range args[1:] {
+			romanize = romanize || slices.Contains(romanizeFlags, arg)
+		}
+	}
+	text := botUtils.GetCmdText(content)
+	for {
+		fields := strings.Fields(text)
+		if len(fields) == 0 || !slices.Contains(romanizeFlags, fields[0]) {
+			break
+		}
+		romanize = true
+		text = strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+	}
+	return text, romanize
+}
+
+// romanization returns the Latin-script form of whichever side of a translation can be romanized,
+// preferring the translated text, or an empty string if neither can.
+//
+// @param fromLang: The source language.
+// @param toLang: The target language.
+// @param src: The source text.
+// @param translated: The translated text.
+// @return string: The romanization to append under the translation.
+func romanization(fromLang, toLang language.Tag, src, translated string) string {
+	roman, ok := botRomanize.ForLanguage(toLang, translated)
+	if !ok {
+		if roman, ok = botRomanize.ForLanguage(fromLang, src); !ok {
+			return ""
+		}
+	}
+	return "Romanized: " + strings.TrimSpace(roman) + "\n"
+}
+
+// Translate performs the translation through the bot's key pool using the provided context.
 // It takes the English strings to be translated, the source language tag, and the target language tag as parameters.
+// The estimated symbol cost is reserved against the monthly budget before the provider is called.
 // It returns the translated string and an error if the translation fails.
 //
-// @param gClient: The translation client.
 // @param ctx: The context for the translation.
+// @param guildID: The server the translation is billed to.
 // @param engStrs: The English strings to be translated.
 // @param srcTag: The source language tag.
 // @param tgtTag: The target language tag.
 // @return string: The translated string.
 // @return error: An error if the translation fails.
-func Translate(gClient *translate.Client, ctx context.Context,
+func (h *Handler) Translate(ctx context.Context, guildID uint,
 	engStrs []string, srcTag language.Tag, tgtTag language.Tag) (string, error) {
-	if gClient == nil {
-		return "", errors.New("google client not initialized")
+	// The provider bills characters, not bytes
+	charCnt := 0
+	for _, str := range engStrs {
+		charCnt += utf8.RuneCountInString(str)
+	}
+	reservation, err := h.stats.ReserveSymbols(guildID, charCnt)
+	if err != nil {
+		return "", err
 	}
 
-	resps, err := gClient.Translate(ctx, engStrs, tgtTag,
-		&translate.Options{
-			Source: srcTag,
-			Format: translate.Text,
-		})
+	finalString, err := h.pool.translate(ctx, engStrs, srcTag, tgtTag, charCnt)
+	if err != nil {
+		reservation.Release()
+		return finalString, err
+	}
+	if reservation.Settle(charCnt) {
+		h.budgetWarnPending.Store(true)
+	}
+
+	return finalString, nil
+}
+
+// providerTranslate sends the strings to the provider and joins the results without touching the budget.
+// Servers that use their own API key translate through here directly.
+//
+// @param gClient: The translation client.
+// @param ctx: The context for the translation.
+// @param engStrs: The strings to be translated.
+// @param srcTag: The source language tag.
+// @param tgtTag: The target language tag.
+// @return string: The translated string.
+// @return error: An error if the translation fails.
+func providerTranslate(gClient *translate.Client, ctx context.Context,
+	engStrs []string, srcTag language.Tag, tgtTag language.Tag) (string, error) {
+	texts, err := providerTranslateEach(gClient, ctx, engStrs, srcTag, tgtTag)
 	if err != nil {
-		fmt.Println("Failed to translate, error: ", err)
 		return "Error Translating, please make sure the input language is Japanese", err
 	}
 
 	//put all strings together
 	var finalString string
-	charCnt := 0
-	for _, t := range resps {
-		finalString += t.Text + "\n"
-		charCnt += len(t.Text)
+	for _, t := range texts {
+		finalString += t + "\n"
 	}
-	botdbStats.UpdateLocalSymbolCnt(charCnt)
 
 	return finalString, nil
 }
+
+// providerTranslateEach sends the strings to the provider and returns the translation of each one.
+//
+// @param gClient: The translation client.
+// @param ctx: The context for the translation.
+// @param engStrs: The strings to be translated.
+// @param srcTag: The source language tag.
+// @param tgtTag: The target language tag.
+// @return []string: The translations, in the order of engStrs.
+// @return error: An error if the translation fails.
+func providerTranslateEach(gClient *translate.Client, ctx context.Context,
+	engStrs []string, srcTag language.Tag, tgtTag language.Tag) ([]string, error) {
+	resps, err := gClient.Translate(ctx, engStrs, tgtTag,
+		&translate.Options{
+			Source: srcTag,
+			Format: translate.Text,
+		})
+	if err != nil {
+		fmt.Println("Failed to translate, error: ", err)
+		return nil, err
+	}
+	texts := make([]string, len(resps))
+	for n, t := range resps {
+		texts[n] = t.Text
+	}
+	return texts, nil
+}
@@ -1,17 +1,189 @@
 package botUtils
 
 import (
+	"errors"
 	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
 )
 
+var ownerLock = &sync.Mutex{}
+var ownerID_ string
+
+// GetCmd returns the text between the first '<' and its matching '>'.
+// Nested brackets such as user mentions '<@123>' are kept as part of the command.
 func GetCmd(s string) string {
 
 	i := strings.Index(s, "<")
 	if i >= 0 {
-		j := strings.Index(s, ">")
-		if j >= 0 {
-			return s[i+1 : j]
+		depth := 0
+		for j := i; j < len(s); j++ {
+			switch s[j] {
+			case '<':
+				depth++
+			case '>':
+				depth--
+				if depth == 0 {
+					return s[i+1 : j]
+				}
+			}
 		}
 	}
 	return ""
 }
+
+// GetCmdArgs returns the whitespace separated arguments that follow name inside the command.
+// Direct messages carry the command without brackets, so the whole content is used there.
+func GetCmdArgs(content, name string) []string {
+	cmd := GetCmd(content)
+	if cmd == "" {
+		cmd = content
+	}
+	return strings.Fields(strings.TrimPrefix(strings.TrimSpace(cmd), name))
+}
+
+// getOwnerID looks up the owner of the bot application and caches it once found.
+// A failed lookup is not cached, so the next call tries again.
+func getOwnerID(s *discordgo.Session) string {
+	ownerLock.Lock()
+	defer ownerLock.Unlock()
+	if ownerID_ == "" {
+		app, err := s.Application("@me")
+		if err != nil || app.Owner == nil {
+			return ""
+		}
+		ownerID_ = app.Owner.ID
+	}
+	return ownerID_
+}
+
+// IsBotOwner reports whether userID belongs to the owner of the bot application.
+func IsBotOwner(s *discordgo.Session, userID string) bool {
+	owner := getOwnerID(s)
+	return owner != "" && owner == userID
+}
+
+// SendOwnerDM sends msg to the bot owner as a direct message.
+func SendOwnerDM(s *discordgo.Session, msg string) error {
+	owner := getOwnerID(s)
+	if owner == "" {
+		return errors.New("bot owner unknown")
+	}
+	channel, err := s.UserChannelCreate(owner)
+	if err != nil {
+		return err
+	}
+	_, err = s.ChannelMessageSend(channel.ID, msg)
+	return err
+}
+
+// IsGuildAdmin reports whether userID owns the guild or holds a role with administrator permission.
+// It works outside the guild's channels, e.g. from a direct message.
+func IsGuildAdmin(s *discordgo.Session, guildID, userID string) bool {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		if guild, err = s.Guild(guildID); err != nil {
+			return false
+		}
+	}
+	if guild.OwnerID == userID {
+		return true
+	}
+	member, err := s.State.Member(guildID, userID)
+	if err != nil {
+		if member, err = s.GuildMember(guildID, userID); err != nil {
+			return false
+		}
+	}
+	for _, roleID := range member.Roles {
+		for _, role := range guild.Roles {
+			if role.ID == roleID && role.Permissions&discordgo.PermissionAdministrator != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MemberRoles returns the IDs of the roles userID holds in the guild, nil if the member is unknown.
+func MemberRoles(s *discordgo.Session, guildID, userID string) []string {
+	member, err := s.State.Member(guildID, userID)
+	if err != nil {
+		if member, err = s.GuildMember(guildID, userID); err != nil {
+			return nil
+		}
+	}
+	return member.Roles
+}
+
+// GetCmdText returns the message text that follows the command.
+// Direct messages carry the command without brackets, so the first word is dropped there.
+func GetCmdText(content string) string {
+	cmd := GetCmd(content)
+	if cmd == "" {
+		fields := strings.SplitN(strings.TrimSpace(content), " ", 2)
+		if len(fields) < 2 {
+			return ""
+		}
+		return strings.TrimSpace(fields[1])
+	}
+	i := strings.Index(content, "<"+cmd+">")
+	return strings.TrimSpace(content[i+len(cmd)+2:])
+}
+
+// maxMessageLen is the longest message discord accepts
+const maxMessageLen = 2000
+
+// ChannelMessageSendLong sends str to a channel, split on line breaks into messages discord accepts.
+func ChannelMessageSendLong(s *discordgo.Session, channelID, str string) error {
+	var msg string
+	for _, line := range strings.SplitAfter(str, "\n") {
+		for len(line) > maxMessageLen {
+			if msg != "" {
+				if _, err := s.ChannelMessageSend(channelID, msg); err != nil {
+					return err
+				}
+				msg = ""
+			}
+			cut := maxMessageLen
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if _, err := s.ChannelMessageSend(channelID, line[:cut]); err != nil {
+				return err
+			}
+			line = line[cut:]
+		}
+		if len(msg)+len(line) > maxMessageLen {
+			if _, err := s.ChannelMessageSend(channelID, msg); err != nil {
+				return err
+			}
+			msg = ""
+		}
+		msg += line
+	}
+	if strings.TrimSpace(msg) != "" {
+		_, err := s.ChannelMessageSend(channelID, msg)
+		return err
+	}
+	return nil
+}
+
+// SendDM sends str to a user as one or more direct messages.
+func SendDM(s *discordgo.Session, userID, str string) error {
+	channel, err := s.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+	return ChannelMessageSendLong(s, channel.ID, str)
+}
+
+// InteractionUser returns the user who triggered an interaction, in a server or a direct message.
+func InteractionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
@@ -0,0 +1,53 @@
+package botWotd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// postDue posts the word of the day of every server whose local post time has passed today
+// and that has not posted yet today.
+func (h *Handler) postDue(s *discordgo.Session) {
+	configs, err := h.stats.GetEnabledWordOfTheDayConfigs()
+	if err != nil {
+		fmt.Printf("wotd::postDue::%s\n", err.Error())
+		return
+	}
+	for n := range configs {
+		config := &configs[n]
+		now := time.Now().In(config.Location())
+		today := now.Format(time.DateOnly)
+		// Post times are saved as HH:MM, so they compare in time order
+		if config.LastPostedDate == today || now.Format("15:04") < config.PostTime {
+			continue
+		}
+		// Claim the day before posting so a restart or a failed post never posts twice
+		claimed, err := h.stats.ClaimWordOfTheDay(config.ID, today)
+		if err != nil {
+			fmt.Printf("wotd::postDue::%s\n", err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := h.PostWordOfTheDay(s, config, today); err != nil {
+			fmt.Printf("wotd::postDue::server %d: %s\n", config.DiscordServerID, err.Error())
+		}
+	}
+}
+
+// RunScheduler posts each server's word of the day at its local post time, checking every interval.
+// A post missed while the bot was down is made once it is back the same day.
+//
+// @param s: The discord session to post with.
+// @param interval: How often to check for due posts.
+func (h *Handler) RunScheduler(s *discordgo.Session, interval time.Duration) {
+	h.postDue(s)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.postDue(s)
+	}
+}
@@ -0,0 +1,301 @@
+package botWotd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	botdbStats "github.com/xtraice/go-discord-bot/pkg/bot_dbstats"
+	botRomanize "github.com/xtraice/go-discord-bot/pkg/bot_romanize"
+	botUtils "github.com/xtraice/go-discord-bot/pkg/bot_utils"
+	"golang.org/x/text/language"
+)
+
+// maxWordListSize is the largest word list attachment accepted, in bytes
+const maxWordListSize = 1 << 20
+
+// Handler serves the word of the day commands, keeping the settings, word lists and posts in the bot's stats.
+type Handler struct {
+	stats *botdbStats.Handler
+}
+
+// NewHandler returns a handler of the word of the day commands.
+//
+// @param stats: The bot's stats.
+// @return *Handler: The handler.
+func NewHandler(stats *botdbStats.Handler) *Handler {
+	return &Handler{stats: stats}
+}
+
+// Cmds returns the word of the day commands served by the handler.
+func (h *Handler) Cmds() map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	return map[string]func(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int){
+		"wotd": h.handleWotdCommand,
+	}
+}
+
+var WotdHelpCmds = map[string]string{
+	"<wotd>": "Admin: word of the day settings '<wotd channel #channel|here>', '<wotd lang <code>>', '<wotd time HH:MM>', " +
+		"'<wotd timezone <zone>>', '<wotd on|off>', '<wotd now>', import words '<wotd import [lang]>' with a CSV attachment " +
+		"of word,translation,example,example meaning or clear them '<wotd clear [lang]>'",
+}
+
+func (h *Handler) handleWotdCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID, authorID int) {
+	fmt.Println("Got 'wotd' Cmd")
+	if m.GuildID == "" || !botUtils.IsGuildAdmin(s, m.GuildID, m.Author.ID) {
+		s.ChannelMessageSend(m.ChannelID, "Sorry, you don't have the privilege to use that command.")
+		return
+	}
+	config := h.stats.GetWordOfTheDayConfig(uint(guildID))
+	args := botUtils.GetCmdArgs(m.Content, "wotd")
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, h.FormatConfig(config))
+		return
+	}
+
+	switch args[0] {
+	case "now":
+		if err := h.PostWordOfTheDay(s, config, time.Now().In(config.Location()).Format(time.DateOnly)); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Failed to post the word of the day: "+err.Error())
+		}
+		return
+	case "import":
+		h.handleWordListImport(s, m, guildID, config, args[1:])
+		return
+	case "clear":
+		lang := config.Language
+		if len(args) > 1 {
+			lang = args[1]
+		}
+		if err := h.stats.ClearWordList(uint(guildID), lang); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Failed to clear the word list: "+err.Error())
+			return
+		}
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Cleared the %s word list.", lang))
+		return
+	}
+
+	if err := applySetting(config, m, args); err != nil {
+		s.ChannelMessageSend(m.ChannelID, err.Error())
+		return
+	}
+	if err := h.stats.SaveWordOfTheDayConfig(config); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to save the word of the day settings: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, h.FormatConfig(config))
+	fmt.Println("End Cmd")
+}
+
+// applySetting changes the config setting named by args[0].
+func applySetting(config *botdbStats.WordOfTheDayConfig, m *discordgo.MessageCreate, args []string) error {
+	if args[0] == "on" || args[0] == "off" {
+		if args[0] == "on" && (config.ChannelID == "" || config.Language == "") {
+			return fmt.Errorf("Set a channel and a language before turning the word of the day on.")
+		}
+		config.Enabled = args[0] == "on"
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: <wotd channel|lang|time|timezone <value>>")
+	}
+	switch args[0] {
+	case "channel":
+		if args[1] == "here" {
+			config.ChannelID = m.ChannelID
+		} else {
+			config.ChannelID = strings.TrimSuffix(strings.TrimPrefix(args[1], "<#"), ">")
+		}
+	case "lang":
+		tag, err := language.Parse(args[1])
+		if err != nil {
+			return fmt.Errorf("Unknown language %q.", args[1])
+		}
+		config.Language = tag.String()
+	case "time":
+		postTime, err := time.Parse("15:04", args[1])
+		if err != nil {
+			return fmt.Errorf("Time must be HH:MM, for example 09:00.")
+		}
+		config.PostTime = postTime.Format("15:04")
+	case "timezone":
+		if _, err := time.LoadLocation(args[1]); err != nil {
+			return fmt.Errorf("Unknown time zone %q, use a name like Asia/Tokyo.", args[1])
+		}
+		config.Timezone = args[1]
+	default:
+		return fmt.Errorf("Usage: <wotd channel|lang|time|timezone <value>>")
+	}
+	return nil
+}
+
+// FormatConfig returns a server's word of the day settings as a string.
+func (h *Handler) FormatConfig(config *botdbStats.WordOfTheDayConfig) string {
+	state := "off"
+	if config.Enabled {
+		state = "on"
+	}
+	channel := "not set"
+	if config.ChannelID != "" {
+		channel = "<#" + config.ChannelID + ">"
+	}
+	lang := config.Language
+	if lang == "" {
+		lang = "not set"
+	}
+	return fmt.Sprintf("Word of the day is %s\nChannel: %s\nLanguage: %s (%d words in the word list)\nPosted at %s %s",
+		state, channel, lang, h.stats.CountWordList(config.DiscordServerID, config.Language), config.PostTime, config.Timezone)
+}
+
+func (h *Handler) handleWordListImport(s *discordgo.Session, m *discordgo.MessageCreate, guildID int,
+	config *botdbStats.WordOfTheDayConfig, args []string) {
+	lang := config.Language
+	if len(args) > 0 {
+		lang = args[0]
+	}
+	if lang == "" || len(m.Attachments) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: <wotd import [lang]> with a CSV attachment of word,translation,example,example meaning")
+		return
+	}
+	attachment := m.Attachments[0]
+	if attachment.Size > maxWordListSize {
+		s.ChannelMessageSend(m.ChannelID, "The word list is too large.")
+		return
+	}
+	resp, err := s.Client.Get(attachment.URL)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to download the word list: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWordListSize))
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to download the word list: "+err.Error())
+		return
+	}
+	entries, err := ParseWordList(data, uint(guildID), lang)
+	if err == nil {
+		err = h.stats.ImportWordList(entries)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Failed to import the word list: "+err.Error())
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Imported %d %s words.", len(entries), lang))
+}
+
+// ParseWordList reads a word list of word, translation, example and example meaning columns.
+// Columns are separated by commas, or tabs if the first line has one. A header row starting with 'word' is skipped.
+//
+// @param data: The word list file.
+// @param guildID: The server's ID
+// @param lang: The language of the words.
+// @return []botdbStats.WordListEntry: The words.
+// @return error: An error if the file is not a valid word list.
+func ParseWordList(data []byte, guildID uint, lang string) ([]botdbStats.WordListEntry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(data))
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.ContainsRune(firstLine, '\t') {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.Comment = '#'
+
+	var entries []botdbStats.WordListEntry
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for n := range record {
+			record[n] = strings.TrimSpace(record[n])
+		}
+		if line == 1 && strings.EqualFold(record[0], "word") {
+			continue
+		}
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("line %d needs a word and a translation", line)
+		}
+		record = append(record, "", "")
+		entries = append(entries, botdbStats.WordListEntry{DiscordServerID: guildID, Language: lang,
+			Word: record[0], Translation: record[1], Example: record[2], ExampleMeaning: record[3]})
+	}
+	return entries, nil
+}
+
+// FormatWordOfTheDay returns the post for a word in lang.
+func FormatWordOfTheDay(word *botdbStats.WordOfTheDay, lang string) string {
+	str := fmt.Sprintf("**Word of the day** (%s)\n# %s\n", lang, word.Word)
+	tag, _ := language.Parse(lang)
+	if roman, ok := botRomanize.ForLanguage(tag, word.Word); ok {
+		str += "Romanized: " + roman + "\n"
+	}
+	str += "Meaning: " + word.Translation + "\n"
+	if word.Example != "" {
+		str += "\nExample: " + word.Example + "\n"
+		if roman, ok := botRomanize.ForLanguage(tag, word.Example); ok {
+			str += "Romanized: " + roman + "\n"
+		}
+		if word.ExampleMeaning != "" {
+			str += "→ " + word.ExampleMeaning + "\n"
+		}
+	}
+	return str
+}
+
+// findExample fills in an example sentence for a word without one from a longer phrase
+// of the server's phrasebook containing it.
+func (h *Handler) findExample(guildID uint, lang string, word *botdbStats.WordOfTheDay) {
+	if word.Example != "" {
+		return
+	}
+	phrases, err := h.stats.GetPhrasebook(guildID, lang)
+	if err != nil {
+		return
+	}
+	for _, p := range phrases {
+		text, meaning := p.SourceText, p.TranslatedText
+		if p.TargetLanguage == lang {
+			text, meaning = p.TranslatedText, p.SourceText
+		}
+		if text != word.Word && strings.Contains(text, word.Word) {
+			word.Example, word.ExampleMeaning = text, meaning
+			return
+		}
+	}
+}
+
+// PostWordOfTheDay posts the next word of a server to its word of the day channel.
+//
+// @param s: The discord session.
+// @param config: The server's word of the day settings.
+// @param date: The server's local date of the post.
+// @return error: An error if there is no word to post or the post failed.
+func (h *Handler) PostWordOfTheDay(s *discordgo.Session, config *botdbStats.WordOfTheDayConfig, date string) error {
+	if config.ChannelID == "" || config.Language == "" {
+		return fmt.Errorf("set a channel and a language first")
+	}
+	word, err := h.stats.PickWordOfTheDay(config.DiscordServerID, config.Language)
+	if err != nil {
+		return err
+	}
+	if word == nil {
+		return fmt.Errorf("no %s words in the word list or phrasebook", config.Language)
+	}
+	h.findExample(config.DiscordServerID, config.Language, word)
+	msg, err := s.ChannelMessageSend(config.ChannelID, FormatWordOfTheDay(word, config.Language))
+	if err != nil {
+		return err
+	}
+	h.stats.RecordWordOfTheDay(config.DiscordServerID, word, date, msg.ID)
+	return nil
+}